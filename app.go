@@ -1,32 +1,49 @@
 package goapi
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/hvuhsg/goapi/middlewares"
-	"golang.ngrok.com/ngrok"
-	"golang.ngrok.com/ngrok/config"
 )
 
 // App represents the main application.
 type App struct {
-	title            string
-	version          string
-	description      string
-	termOfServiceURL string
-	license          openapi3.License
-	contact          openapi3.Contact
-	tags             openapi3.Tags
-	security         openapi3.SecurityRequirements
-	externalHandlers map[string]http.Handler
-	middlewares      []middlewares.Middleware
-	views            map[string]*View // A map of View objects keyed by their URL paths
-	openapiDocsURL   string           // URL path for the OpenAPI documentation
-	openapiSchemaURL string           // URL path for the OpenAPI schema
+	title                string
+	version              string
+	description          string
+	termOfServiceURL     string
+	license              openapi3.License
+	contact              openapi3.Contact
+	tags                 openapi3.Tags
+	security             []securityRequirement
+	optionalSecurity     bool
+	externalHandlers     map[string]http.Handler
+	errorHandler         ErrorHandler
+	recovery             RecoveryOptions
+	middlewares          []middlewares.Middleware
+	views                map[string]*View // A map of View objects keyed by their URL paths
+	openapiDocsURL       string           // URL path for the OpenAPI documentation
+	openapiSchemaURL     string           // URL path for the OpenAPI schema
+	openapiYAMLSchemaURL string           // URL path for the OpenAPI schema in YAML
+	openapiDumpFlag      string           // Command line flag that dumps the schema instead of serving
+	openapiVersion       string
+	strictOpenAPI        bool // Fail on startup when the schema is invalid
+	docsUIs              []DocsOptions
+	docsAssetsURL        string // URL path prefix of the embedded docs UI assets
+	docsDisabled         bool
+	docsSecurity         []securityRequirement
+	servers              openapi3.Servers
+	extensions           map[string]interface{}
+
+	routerOnce sync.Once
+	router     http.Handler // Built once, shared by all the listeners
+	routerErr  error        // Set when the router is not built, e.g invalid schema in strict mode
 }
 
 // GoAPI creates a new instance of the App.
@@ -39,17 +56,26 @@ func GoAPI(title string, version string) *App {
 	app.license = openapi3.License{}
 	app.contact = openapi3.Contact{}
 	app.tags = openapi3.Tags{}
+	app.extensions = make(map[string]interface{})
 	app.externalHandlers = make(map[string]http.Handler)
+	app.errorHandler = DefaultErrorHandler
+	app.recovery = RecoveryOptions{RequestIDHeader: "X-Request-ID"}
 	app.middlewares = make([]middlewares.Middleware, 0)
 	app.views = make(map[string]*View)
 	app.openapiDocsURL = "/docs"
 	app.openapiSchemaURL = "/openapi.json"
+	app.openapiYAMLSchemaURL = "/openapi.yaml"
+	app.openapiVersion = OpenAPI30
+	app.docsAssetsURL = "/docs-assets"
 	return app
 }
 
 // registerViews registers each View's path to its corresponding HTTP handler function.
 func (a *App) registerViews(mux *http.ServeMux) {
 	for path, view := range a.views {
+		view.errorHandler = a.errorHandler
+		view.appSecurity = a.security
+		view.appOptionalSecurity = a.optionalSecurity
 		view.applyMiddlewares(a.middlewares)
 		mux.HandleFunc(path, view.requestHandler)
 	}
@@ -57,7 +83,9 @@ func (a *App) registerViews(mux *http.ServeMux) {
 
 // registerInternalViews registers internal views, such as the OpenAPI documentation route.
 func (a *App) registerInternalViews(mux *http.ServeMux) {
-	registerDocs(a, mux) // register OpenAPI documentation route
+	if !a.docsDisabled {
+		registerDocs(a, mux) // register OpenAPI documentation route
+	}
 }
 
 func (a *App) registerExternalHandlers(mux *http.ServeMux) {
@@ -93,10 +121,48 @@ func (a *App) Tag(name string, description string) {
 	a.tags = append(a.tags, &openapi3.Tag{Name: name, Description: description})
 }
 
-// Add security provider
-func (a *App) Security(securiyProvider SecurityProvider) {
-	sec := openapi3.NewSecurityRequirement().Authenticate(securiyProvider.GetName(), securiyProvider.GetScopes()...)
-	a.security = append(a.security, sec)
+// ServerVariable is a variable of a server URL template, e.g {region} in "https://{region}.example.com".
+type ServerVariable struct {
+	Default     string // required
+	Enum        []string
+	Description string
+}
+
+// Server adds server to the docs, the url may contain variables in braces.
+// can be called multiple times for multiple servers.
+func (a *App) Server(url string, description string, variables map[string]ServerVariable) {
+	server := &openapi3.Server{URL: url, Description: description}
+	if len(variables) > 0 {
+		server.Variables = make(map[string]*openapi3.ServerVariable, len(variables))
+		for name, variable := range variables {
+			if variable.Default == "" {
+				panic(fmt.Sprintf("server variable %s requires default value", name))
+			}
+			server.Variables[name] = &openapi3.ServerVariable{Default: variable.Default, Enum: variable.Enum, Description: variable.Description}
+		}
+	}
+
+	a.servers = append(a.servers, server)
+}
+
+// Extension adds vendor extension to the docs root, the name must start with "x-".
+func (a *App) Extension(name string, value interface{}) {
+	requireExtensionName(name)
+	a.extensions[name] = value
+}
+
+// Add security provider, requests to the views must be authenticated by one of the providers.
+// The scopes are required from the provider, defaults to the provider GetScopes.
+// Views can override the app security with View.Security.
+func (a *App) Security(securiyProvider SecurityProvider, scopes ...string) {
+	a.security = append(a.security, newSecurityRequirement(securiyProvider, scopes))
+}
+
+// ErrorHandler sets the function that maps errors returned from views (ActionE),
+// validation errors and panics to responses.
+// default to DefaultErrorHandler.
+func (a *App) ErrorHandler(errorHandler ErrorHandler) {
+	a.errorHandler = errorHandler
 }
 
 // Add middlewares to all routes
@@ -106,22 +172,34 @@ func (a *App) Middlewares(middlewares ...middlewares.Middleware) {
 
 // Make security optional
 func (a *App) OptionalSecurity() {
-	sec := openapi3.NewSecurityRequirement()
-	a.security = append(a.security, sec)
+	a.optionalSecurity = true
 }
 
-// OpenapiDocsURL sets the URL path for the OpenAPI documentation.
-// default to "/openapi.json".
+// OpenapiDocsURL sets the URL path of the default Swagger UI documentation, use Docs for other UIs.
+// default to "/docs".
 func (a *App) OpenapiDocsURL(docsUrl string) {
 	a.openapiDocsURL = docsUrl
 }
 
 // OpenapiSchemaURL sets the URL path for the OpenAPI schema.
-// default to "/docs"
+// default to "/openapi.json"
 func (a *App) OpenapiSchemaURL(schemaUrl string) {
 	a.openapiSchemaURL = schemaUrl
 }
 
+// OpenapiYAMLSchemaURL sets the URL path for the OpenAPI schema in YAML.
+// default to "/openapi.yaml"
+func (a *App) OpenapiYAMLSchemaURL(schemaUrl string) {
+	a.openapiYAMLSchemaURL = schemaUrl
+}
+
+// OpenapiDumpFlag makes the app write the OpenAPI schema to the file given with the command line flag
+// and exit instead of serving, e.g "./app --dump-openapi=openapi.yaml" with OpenapiDumpFlag("dump-openapi").
+// Used in CI to diff the API changes without starting the server.
+func (a *App) OpenapiDumpFlag(name string) {
+	a.openapiDumpFlag = name
+}
+
 // Serve external handler under path
 func (a *App) Include(path string, handler http.Handler) {
 	a.externalHandlers[path] = handler
@@ -140,13 +218,86 @@ func (a *App) Path(path string) *View {
 	return view
 }
 
-// Build mux router
-func (a *App) baseRouter() *http.ServeMux {
+// Build mux router, wrapped with the panic recovery
+func (a *App) baseRouter() http.Handler {
 	mux := http.NewServeMux()
 	a.registerInternalViews(mux)
 	a.registerViews(mux)
 	a.registerExternalHandlers(mux)
-	return mux
+	return a.recoveryHandler(mux)
+}
+
+// handler returns the app router, the router is built on the first call
+// so the views are wrapped with the middlewares only once.
+// Fails in strict OpenAPI mode when the generated schema is invalid.
+func (a *App) handler() (http.Handler, error) {
+	a.dumpOpenAPIIfRequested()
+
+	a.routerOnce.Do(func() {
+		if err := a.ValidateOpenAPI(); err != nil {
+			if a.strictOpenAPI {
+				a.routerErr = err
+				return
+			}
+			log.Printf("invalid openapi schema: %s\n", err)
+		}
+
+		a.router = a.baseRouter()
+	})
+	return a.router, a.routerErr
+}
+
+// dumpOpenAPIIfRequested writes the schema and exits when the dump flag is passed
+func (a *App) dumpOpenAPIIfRequested() {
+	if a.openapiDumpFlag == "" {
+		return
+	}
+
+	path, found := flagValue(os.Args[1:], a.openapiDumpFlag)
+	if !found {
+		return
+	}
+	if path == "" {
+		log.Fatalf("flag -%s requires the schema file path\n", a.openapiDumpFlag)
+	}
+
+	if err := a.WriteOpenAPI(path); err != nil {
+		log.Fatalf("failed to dump openapi schema: %s\n", err)
+	}
+
+	log.Printf("OpenAPI schema written to %s\n", path)
+	os.Exit(0)
+}
+
+// flagValue returns the value of -name=value, --name=value or --name value and whether the flag was passed,
+// the flag package is not used so the app flags are not affected.
+// Values starting with "-" are rejected, they are the next flag and not the value.
+func flagValue(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg {
+			continue
+		}
+
+		var value string
+		switch {
+		case strings.HasPrefix(trimmed, name+"="):
+			value = strings.TrimPrefix(trimmed, name+"=")
+		case trimmed == name:
+			if i+1 < len(args) {
+				value = args[i+1]
+			}
+		default:
+			continue
+		}
+
+		if strings.HasPrefix(value, "-") {
+			value = ""
+		}
+		return value, true
+	}
+
+	return "", false
 }
 
 func (a *App) startup(address string) {
@@ -156,37 +307,20 @@ func (a *App) startup(address string) {
 
 // Run starts the application and listens for incoming requests over HTTP.
 func (a *App) Run(host string, port int) error {
-	mux := a.baseRouter()
+	mux, err := a.handler()
+	if err != nil {
+		return err
+	}
+
 	addr := fmt.Sprintf("%s:%d", host, port)
 	a.startup(addr)
 	return http.ListenAndServe(addr, mux)
 }
 
 // Run starts the application and listens for incoming requests over HTTPS.
-// This method will make the server to only support https requests, to support http and https connections do the following.
-//
-// Run the app with without tls in a gorouting, and then run the app with TLS.
-// NOTE: you can't use the same port for both, the known port for http is 80 and for https is 443.
+// This method will make the server to only support https requests,
+// use RunAutoTLS to get certificates automatically and redirect http requests to https.
+// The certificate is reloaded when the files change, use RunTLSWithOptions for SNI and mutual TLS.
 func (a *App) RunTLS(host string, port int, certFile string, keyFile string) error {
-	mux := a.baseRouter()
-	addr := fmt.Sprintf("%s:%d", host, port)
-	a.startup(addr)
-
-	return http.ListenAndServeTLS(addr, certFile, keyFile, mux)
-}
-
-// Use ngrok tunnel for development
-func (a *App) RunNgrok(authtoken string) error {
-	mux := a.baseRouter()
-	tun, err := ngrok.Listen(context.Background(),
-		config.HTTPEndpoint(),
-		ngrok.WithAuthtoken(authtoken),
-	)
-	if err != nil {
-		return err
-	}
-
-	log.Println("tunnel created:", tun.URL())
-
-	return http.Serve(tun, mux)
+	return a.RunTLSWithOptions(host, port, TLSOptions{Certificates: []CertificateFiles{{CertFile: certFile, KeyFile: keyFile}}})
 }
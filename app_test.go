@@ -1,12 +1,19 @@
 package goapi_test
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/hvuhsg/goapi"
+	"github.com/hvuhsg/goapi/middlewares"
 	"github.com/hvuhsg/goapi/request"
 	"github.com/hvuhsg/goapi/responses"
 	"github.com/hvuhsg/goapi/validators"
@@ -137,3 +144,327 @@ func TestOpenAPISchema(t *testing.T) {
 		t.Errorf("expecting status-code 200 got %d", resp.StatusCode)
 	}
 }
+
+func TestOpenAPIMetadata(t *testing.T) {
+	app := goapi.GoAPI("metadata", "1.0")
+	app.Server("https://{region}.example.com/v1", "production", map[string]goapi.ServerVariable{
+		"region": {Default: "eu", Enum: []string{"eu", "us"}},
+	})
+	app.Extension("x-logo", "https://example.com/logo.png")
+
+	profile := app.Path("/users/profile")
+	profile.Methods(goapi.GET, goapi.POST)
+	profile.Description("User profile")
+	profile.Summary("Profile")
+	profile.ExternalDocs("https://example.com/docs/profile", "profile docs")
+	profile.Extension("x-rate-limit", 100)
+	profile.Action(func(request *request.Request) responses.Response {
+		return responses.NewJSONResponse(responses.Json{}, 200)
+	})
+
+	login := app.Path("/login")
+	login.Methods(goapi.POST)
+	login.Description("Login")
+	login.OperationID("login")
+	login.Action(func(request *request.Request) responses.Response {
+		return responses.NewJSONResponse(responses.Json{}, 200)
+	})
+
+	go app.Run("127.0.0.1", 8094)
+
+	time.Sleep(time.Millisecond * 200)
+
+	resp, err := http.Get("http://127.0.0.1:8094/openapi.json")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	var schema struct {
+		Logo    string `json:"x-logo"`
+		Servers []struct {
+			URL       string `json:"url"`
+			Variables map[string]struct {
+				Default string `json:"default"`
+			} `json:"variables"`
+		} `json:"servers"`
+		Paths map[string]map[string]struct {
+			OperationID  string            `json:"operationId"`
+			Summary      string            `json:"summary"`
+			ExternalDocs map[string]string `json:"externalDocs"`
+			RateLimit    int               `json:"x-rate-limit"`
+		} `json:"paths"`
+	}
+	json.NewDecoder(resp.Body).Decode(&schema)
+
+	if schema.Logo != "https://example.com/logo.png" {
+		t.Errorf("expecting app extension got '%s'", schema.Logo)
+	}
+
+	if len(schema.Servers) != 1 || schema.Servers[0].Variables["region"].Default != "eu" {
+		t.Errorf("expecting server with variables got %v", schema.Servers)
+	}
+
+	get := schema.Paths["/users/profile"]["get"]
+	if get.OperationID != "getUsersProfile" || schema.Paths["/users/profile"]["post"].OperationID != "postUsersProfile" {
+		t.Errorf("expecting default operation ids got '%s' '%s'", get.OperationID, schema.Paths["/users/profile"]["post"].OperationID)
+	}
+
+	if get.Summary != "Profile" || get.ExternalDocs["url"] != "https://example.com/docs/profile" || get.RateLimit != 100 {
+		t.Errorf("expecting operation metadata got %+v", get)
+	}
+
+	if id := schema.Paths["/login"]["post"].OperationID; id != "login" {
+		t.Errorf("expecting operation id 'login' got '%s'", id)
+	}
+}
+
+func TestUniqueOperationIDs(t *testing.T) {
+	app := goapi.GoAPI("operation ids", "1.0")
+	for _, path := range []string{"/users/profile", "/users_profile", "/users-profile", "/users/profile2"} {
+		view := app.Path(path)
+		view.Methods(goapi.GET)
+		view.Description("User profile")
+		view.Action(func(request *request.Request) responses.Response {
+			return responses.NewJSONResponse(responses.Json{}, 200)
+		})
+	}
+
+	// Explicit operation ids are kept, the default id gets the next suffix
+	explicit := app.Path("/profile")
+	explicit.Methods(goapi.GET)
+	explicit.Description("Profile")
+	explicit.OperationID("getUsersProfile3")
+	explicit.Action(func(request *request.Request) responses.Response {
+		return responses.NewJSONResponse(responses.Json{}, 200)
+	})
+
+	doc := app.OpenAPI()
+	expected := map[string]string{
+		"/users-profile":  "getUsersProfile",
+		"/users/profile":  "getUsersProfile2",
+		"/users/profile2": "getUsersProfile22",
+		"/users_profile":  "getUsersProfile4",
+		"/profile":        "getUsersProfile3",
+	}
+	for path, id := range expected {
+		if got := doc.Paths[path].Get.OperationID; got != id {
+			t.Errorf("%s: expecting operation id '%s' got '%s'", path, id, got)
+		}
+	}
+
+	if err := app.ValidateOpenAPI(); err != nil {
+		t.Errorf("not expecting error: %s", err)
+	}
+}
+
+func newSpecApp() *goapi.App {
+	app := goapi.GoAPI("spec", "1.0")
+	app.OpenapiDumpFlag("dump-openapi")
+
+	ping := app.Path("/ping")
+	ping.Methods(goapi.GET)
+	ping.Description("Ping")
+	ping.Action(func(request *request.Request) responses.Response {
+		return responses.NewJSONResponse(responses.Json{}, 200)
+	})
+
+	return app
+}
+
+func TestOpenAPIExport(t *testing.T) {
+	app := newSpecApp()
+
+	if doc := app.OpenAPI(); doc.Info.Title != "spec" || doc.Paths["/ping"].Get == nil {
+		t.Errorf("expecting document with the views got %+v", doc)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"openapi.json", "openapi.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := app.WriteOpenAPI(path); err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		doc, err := openapi3.NewLoader().LoadFromFile(path)
+		if err != nil {
+			t.Fatalf("%s: not expecting error: %s", name, err)
+		}
+		if doc.Paths["/ping"].Get.OperationID != "getPing" {
+			t.Errorf("%s: expecting ping operation got %+v", name, doc.Paths["/ping"])
+		}
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "openapi.yaml")); !strings.Contains(string(data), "openapi: 3.0.0") {
+		t.Errorf("expecting yaml document got %s", data)
+	}
+
+	go app.Run("127.0.0.1", 8095)
+
+	time.Sleep(time.Millisecond * 200)
+
+	resp, err := http.Get("http://127.0.0.1:8095/openapi.yaml")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/yaml" {
+		t.Errorf("expecting yaml schema got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+// TestOpenAPIDumpHelperProcess runs the app with the dump flag, started by TestOpenAPIDumpFlag
+func TestOpenAPIDumpHelperProcess(t *testing.T) {
+	if os.Getenv("GOAPI_DUMP_HELPER") == "" {
+		t.Skip("helper process")
+	}
+
+	newSpecApp().Run("127.0.0.1", 8096)
+	t.Fatal("expecting exit without serving")
+}
+
+func TestOpenAPIDumpFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.yml")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOpenAPIDumpHelperProcess$", "--", "--dump-openapi", path)
+	cmd.Env = append(os.Environ(), "GOAPI_DUMP_HELPER=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("not expecting error: %s %s", err, output)
+	}
+
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "/ping:") {
+		t.Errorf("expecting yaml document got %s", data)
+	}
+
+	// The next flag is not the file path
+	cmd = exec.Command(os.Args[0], "-test.run=^TestOpenAPIDumpHelperProcess$", "--", "--dump-openapi", "-v")
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(), "GOAPI_DUMP_HELPER=1")
+	output, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "requires the schema file path") {
+		t.Errorf("expecting missing path error got %v %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(cmd.Dir, "-v")); err == nil {
+		t.Errorf("expecting no schema written to the next flag")
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	app := goapi.GoAPI("errors", "1.0")
+
+	users := app.Path("/users")
+	users.Methods(goapi.GET)
+	users.Description("get user")
+	users.Parameter("id", goapi.QUERY, validators.VRequired{}, validators.VIsInt{})
+	users.ActionE(func(request *request.Request) (responses.Response, error) {
+		if request.GetInt("id") != 1 {
+			return nil, responses.NotFound("user not found")
+		}
+		return responses.NewJSONResponse(responses.Json{"id": 1}, 200), nil
+	})
+
+	crash := app.Path("/crash")
+	crash.Methods(goapi.GET)
+	crash.Description("panics")
+	crash.Action(func(request *request.Request) responses.Response {
+		panic("boom")
+	})
+
+	go app.Run("127.0.0.1", 8082)
+
+	time.Sleep(time.Millisecond * 200)
+
+	cases := []struct {
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"/users?id=1", 200, `{"id":1}`},
+		{"/users?id=2", 404, `{"code":404,"error":"Not Found","message":"user not found"}`},
+		{"/users", 422, `{"code":422,"details":{"parameter":"id"},"error":"Unprocessable Entity","message":"parameter id is required"}`},
+		{"/crash", 500, `{"code":500,"error":"Internal Server Error","message":"Internal Server Error"}`},
+	}
+
+	for _, c := range cases {
+		resp, err := http.Get("http://127.0.0.1:8082" + c.url)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != c.expectedCode {
+			t.Errorf("%s: expecting status-code %d got %d", c.url, c.expectedCode, resp.StatusCode)
+		}
+
+		if string(respBody) != c.expectedBody {
+			t.Errorf("%s: expecting response body to be '%s' got '%s'", c.url, c.expectedBody, respBody)
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	app := goapi.GoAPI("recovery", "1.0")
+
+	reports := make(chan *goapi.PanicReport, 2)
+	app.Recovery(goapi.RecoveryOptions{
+		Debug:   true,
+		OnPanic: func(report *goapi.PanicReport) { reports <- report },
+	})
+
+	app.Include("/external", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("external boom")
+	}))
+
+	slow := app.Path("/slow")
+	slow.Methods(goapi.GET)
+	slow.Description("panics in the timeout middleware goroutine")
+	slow.Middlewares(middlewares.TimeoutMiddleware{Timeout: time.Second})
+	slow.Action(func(request *request.Request) responses.Response {
+		panic("view boom")
+	})
+
+	go app.Run("127.0.0.1", 8083)
+
+	time.Sleep(time.Millisecond * 200)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8083/external", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	if resp.StatusCode != 500 {
+		t.Errorf("expecting status-code 500 got %d", resp.StatusCode)
+	}
+
+	if resp.Header.Get("X-Request-ID") != "abc" {
+		t.Errorf("expecting request id in the response got '%s'", resp.Header.Get("X-Request-ID"))
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(respBody), "external boom") || !strings.Contains(string(respBody), "Stack trace") {
+		t.Errorf("expecting debug page with panic value and stack trace")
+	}
+
+	select {
+	case report := <-reports:
+		if report.Value != "external boom" || report.RequestID != "abc" || len(report.Stack) == 0 {
+			t.Errorf("unexpected panic report %+v", report)
+		}
+	default:
+		t.Errorf("expecting OnPanic hook to be called")
+	}
+
+	if _, err := http.Get("http://127.0.0.1:8083/slow"); err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	select {
+	case report := <-reports:
+		if report.Value != "view boom" || !strings.Contains(string(report.Stack), "app_test.go") {
+			t.Errorf("expecting view panic with the view stack got %v\n%s", report.Value, report.Stack)
+		}
+	default:
+		t.Errorf("expecting OnPanic hook to be called")
+	}
+}
@@ -0,0 +1,141 @@
+package goapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AutoTLSOptions configures RunAutoTLS.
+type AutoTLSOptions struct {
+	Domains []string // Domains to get certificates for, required
+	Email   string   // Contact email of the ACME account, used for expiry notices
+
+	// Certificates and account key cache, default to autocert.DirCache("certs").
+	// Implement autocert.Cache to share the certificates between replicas (database, object storage, ...).
+	Cache autocert.Cache
+
+	// ACME directory URL, default to Let's Encrypt production.
+	// Use Let's Encrypt staging or a local test server (pebble) for testing.
+	DirectoryURL string
+
+	// Client used to talk to the ACME server, e.g. a client that trusts the CA of a local test server.
+	HTTPClient *http.Client
+
+	// Address of the http listener that answers ACME HTTP-01 challenges and redirects everything else to https,
+	// default to ":80".
+	RedirectAddr    string
+	DisableRedirect bool
+}
+
+// RunAutoTLS starts the application over HTTPS with certificates obtained automatically using ACME (Let's Encrypt).
+// Certificates are obtained on the first request to each domain and renewed before they expire.
+//
+// Unless disabled, a second listener on RedirectAddr answers HTTP-01 challenges and redirects http requests to https.
+func (a *App) RunAutoTLS(host string, port int, options AutoTLSOptions) error {
+	if len(options.Domains) == 0 {
+		return errors.New("auto tls requires at least one domain")
+	}
+
+	handler, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	manager := newAutocertManager(options)
+	addr := fmt.Sprintf("%s:%d", host, port)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if !options.DisableRedirect {
+		redirectAddr := options.RedirectAddr
+		if redirectAddr == "" {
+			redirectAddr = ":80"
+		}
+
+		redirectListener, err := net.Listen("tcp", redirectAddr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		go func() {
+			err := http.Serve(redirectListener, manager.HTTPHandler(httpsRedirectHandler(port, options.Domains)))
+			log.Printf("redirect listener stopped: %s\n", err)
+		}()
+	}
+
+	server := &http.Server{Handler: handler, TLSConfig: manager.TLSConfig()}
+	a.startup(addr)
+
+	return server.ServeTLS(listener, "", "")
+}
+
+func newAutocertManager(options AutoTLSOptions) *autocert.Manager {
+	cache := options.Cache
+	if cache == nil {
+		cache = autocert.DirCache("certs")
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(options.Domains...),
+		Cache:      cache,
+		Email:      options.Email,
+	}
+
+	if options.DirectoryURL != "" || options.HTTPClient != nil {
+		manager.Client = &acme.Client{DirectoryURL: options.DirectoryURL, HTTPClient: options.HTTPClient}
+	}
+
+	return manager
+}
+
+// httpsRedirectHandler redirects requests to the same URL over https on port,
+// only hosts of the domains are redirected, the Host header is set by the client.
+func httpsRedirectHandler(port int, domains []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if !hostInDomains(host, domains) {
+			http.Error(w, "unknown host", http.StatusBadRequest)
+			return
+		}
+
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		// 308 keeps the method and body of non GET requests
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+
+		http.Redirect(w, r, target, code)
+	})
+}
+
+func hostInDomains(host string, domains []string) bool {
+	for _, domain := range domains {
+		if strings.EqualFold(host, domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package goapi
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CredentialStore verifies username and password, used by the Basic security provider.
+type CredentialStore interface {
+	Authenticate(username string, password string) bool
+}
+
+// DigestCredentialStore is a credential store that can compute the digest HA1
+// (H(username:realm:password)) of a user, required by the Digest security provider.
+type DigestCredentialStore interface {
+	CredentialStore
+	DigestHA1(username string, realm string, algorithm string) (ha1 string, ok bool)
+}
+
+// Password compared against for unknown users of the MemoryCredentialStore
+const dummyPassword = "unknown user"
+
+// MemoryCredentialStore keeps plain text passwords in memory, supports Basic and Digest.
+type MemoryCredentialStore struct {
+	mu    sync.RWMutex
+	users map[string]string
+}
+
+// NewMemoryCredentialStore creates store from username to password map
+func NewMemoryCredentialStore(users map[string]string) *MemoryCredentialStore {
+	store := &MemoryCredentialStore{users: make(map[string]string, len(users))}
+	for username, password := range users {
+		store.users[username] = password
+	}
+	return store
+}
+
+// Set adds or updates user password
+func (s *MemoryCredentialStore) Set(username string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = password
+}
+
+// Delete removes user
+func (s *MemoryCredentialStore) Delete(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, username)
+}
+
+func (s *MemoryCredentialStore) Authenticate(username string, password string) bool {
+	s.mu.RLock()
+	expected, ok := s.users[username]
+	s.mu.RUnlock()
+
+	if !ok {
+		// Compare against dummy password so unknown users take the same time
+		expected = dummyPassword
+	}
+
+	// Compare fixed size digests, ConstantTimeCompare returns early for different lengths
+	sent := sha256.Sum256([]byte(password))
+	stored := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(sent[:], stored[:]) == 1 && ok
+}
+
+func (s *MemoryCredentialStore) DigestHA1(username string, realm string, algorithm string) (string, bool) {
+	s.mu.RLock()
+	password, ok := s.users[username]
+	s.mu.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+
+	return digestHash(algorithm, username+":"+realm+":"+password), true
+}
+
+// HtpasswdCredentialStore reads users from htpasswd file with bcrypt hashes
+// (created with `htpasswd -B`), supports Basic only.
+type HtpasswdCredentialStore struct {
+	path  string
+	mu    sync.RWMutex
+	users map[string][]byte
+}
+
+// dummyHash is compared against for unknown users so they take the same time as known users
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// NewHtpasswdCredentialStore loads htpasswd file, entries that are not bcrypt hashes are rejected.
+func NewHtpasswdCredentialStore(path string) (*HtpasswdCredentialStore, error) {
+	store := &HtpasswdCredentialStore{path: path}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload reads the htpasswd file again, the current users are kept when the file is invalid.
+func (s *HtpasswdCredentialStore) Reload() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, passwordHash, found := strings.Cut(line, ":")
+		if !found || username == "" {
+			return fmt.Errorf("%s:%d: invalid htpasswd entry", s.path, lineNumber)
+		}
+
+		if _, err := bcrypt.Cost([]byte(passwordHash)); err != nil {
+			return fmt.Errorf("%s:%d: user %s: only bcrypt hashes are supported", s.path, lineNumber, username)
+		}
+
+		users[username] = []byte(passwordHash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *HtpasswdCredentialStore) Authenticate(username string, password string) bool {
+	s.mu.RLock()
+	passwordHash, ok := s.users[username]
+	s.mu.RUnlock()
+
+	if !ok {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword(passwordHash, []byte(password)) == nil
+}
+
+// digestHash hashes data with the digest algorithm (MD5 or SHA-256) and returns it hex encoded
+func digestHash(algorithm string, data string) string {
+	var h hash.Hash
+	if strings.EqualFold(algorithm, "MD5") {
+		h = md5.New()
+	} else {
+		h = sha256.New()
+	}
+
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
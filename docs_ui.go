@@ -0,0 +1,297 @@
+package goapi
+
+//go:generate go run docsui/generate.go
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/hvuhsg/goapi/request"
+)
+
+// Docs UI bundles embedded in the binary, the pinned versions are listed in docsui/assets.txt
+//
+//go:embed docsui
+var docsUIFiles embed.FS
+
+// DocsUI is a documentation UI that renders the OpenAPI schema.
+type DocsUI string
+
+const (
+	SwaggerUI DocsUI = "swagger-ui"
+	ReDoc     DocsUI = "redoc"
+	RapiDoc   DocsUI = "rapidoc"
+	Scalar    DocsUI = "scalar"
+)
+
+// DocsOptions configures documentation UI route.
+type DocsOptions struct {
+	UI    DocsUI
+	Path  string // URL path of the UI, required
+	Title string // default to the app title
+
+	// Configuration passed to the UI, e.g {"docExpansion": "none"} for Swagger UI,
+	// {"hideDownloadButton": true} for ReDoc, {"theme": "dark"} for RapiDoc (attributes) and Scalar.
+	Config map[string]interface{}
+
+	// URLs of the UI script and stylesheet (Swagger UI only), default to the bundles embedded in the binary.
+	// Swagger UI is embedded, ReDoc, RapiDoc and Scalar require ScriptURL, e.g a mirror on an internal server
+	// or the pinned CDN URL from docsui/assets.txt.
+	ScriptURL string
+	StyleURL  string
+}
+
+// Bundle files of the UIs in docsui, the script and the stylesheet
+var docsUIBundles = map[DocsUI][2]string{
+	SwaggerUI: {"swagger-ui/swagger-ui-bundle.js", "swagger-ui/swagger-ui.css"},
+	ReDoc:     {"redoc/redoc.standalone.js"},
+	RapiDoc:   {"rapidoc/rapidoc-min.js"},
+	Scalar:    {"scalar/standalone.js"},
+}
+
+// Default configuration of the Swagger UI
+var swaggerUIDefaults = map[string]interface{}{
+	"layout":               "BaseLayout",
+	"deepLinking":          true,
+	"showExtensions":       true,
+	"showCommonExtensions": true,
+}
+
+var docsUITemplates = map[DocsUI]*template.Template{
+	SwaggerUI: template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<link rel="stylesheet" href="{{ .Style }}">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{ .Script }}"></script>
+<script>
+const config = {{ .Config }};
+config.url = {{ .SchemaURL }};
+config.dom_id = "#swagger-ui";
+config.presets = [SwaggerUIBundle.presets.apis];
+window.ui = SwaggerUIBundle(config);
+</script>
+</body>
+</html>
+`)),
+	ReDoc: template.Must(template.New("redoc").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+</head>
+<body>
+<div id="redoc"></div>
+<script src="{{ .Script }}"></script>
+<script>
+Redoc.init({{ .SchemaURL }}, {{ .Config }}, document.getElementById("redoc"));
+</script>
+</body>
+</html>
+`)),
+	RapiDoc: template.Must(template.New("rapidoc").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<script type="module" src="{{ .Script }}"></script>
+</head>
+<body>
+<rapi-doc id="rapidoc"></rapi-doc>
+<script>
+const rapidoc = document.getElementById("rapidoc");
+for (const [name, value] of Object.entries({{ .Config }})) {
+	rapidoc.setAttribute(name, value);
+}
+rapidoc.setAttribute("spec-url", {{ .SchemaURL }});
+</script>
+</body>
+</html>
+`)),
+	Scalar: template.Must(template.New("scalar").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+</head>
+<body>
+<script id="api-reference"></script>
+<script>
+const reference = document.getElementById("api-reference");
+reference.dataset.url = {{ .SchemaURL }};
+reference.dataset.configuration = JSON.stringify({{ .Config }});
+</script>
+<script src="{{ .Script }}"></script>
+</body>
+</html>
+`)),
+}
+
+// Docs sets the documentation UIs, each UI is served on its own path.
+// default to Swagger UI on OpenapiDocsURL, call without options to serve only the schema.
+//
+//	app.Docs(
+//		goapi.DocsOptions{UI: goapi.SwaggerUI, Path: "/docs"},
+//		goapi.DocsOptions{UI: goapi.ReDoc, Path: "/redoc", Config: map[string]interface{}{"hideDownloadButton": true}},
+//	)
+func (a *App) Docs(options ...DocsOptions) {
+	for _, option := range options {
+		if _, ok := docsUITemplates[option.UI]; !ok {
+			panic("unknown docs ui " + string(option.UI))
+		}
+		if option.Path == "" {
+			panic("docs ui " + string(option.UI) + " requires path")
+		}
+
+		bundle := docsUIBundles[option.UI]
+		if option.ScriptURL == "" && !docsAssetEmbedded(bundle[0]) {
+			panic("docs ui " + string(option.UI) + " is not embedded, set DocsOptions.ScriptURL")
+		}
+		if option.StyleURL == "" && bundle[1] != "" && !docsAssetEmbedded(bundle[1]) {
+			panic("docs ui " + string(option.UI) + " is not embedded, set DocsOptions.StyleURL")
+		}
+	}
+
+	a.docsUIs = options
+}
+
+// DisableDocs removes the documentation UIs and the schema routes.
+func (a *App) DisableDocs() {
+	a.docsDisabled = true
+}
+
+// DocsSecurity protects the documentation UIs and the schema routes with the security provider.
+// can be called multiple times, the request must be authenticated by one of the providers.
+func (a *App) DocsSecurity(provider SecurityProvider, scopes ...string) {
+	a.docsSecurity = append(a.docsSecurity, newSecurityRequirement(provider, scopes))
+}
+
+// protectDocs authorizes the requests to the docs with the docs security
+func (a *App) protectDocs(handler http.Handler) http.Handler {
+	if len(a.docsSecurity) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request.NewRequest(r)
+		if err := authorize(a.docsSecurity, false, req); err != nil {
+			writeResponse(w, a.errorHandler(req, err))
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// docsUIOptions returns the configured UIs, default to Swagger UI
+func (a *App) docsUIOptions() []DocsOptions {
+	if a.docsUIs != nil {
+		return a.docsUIs
+	}
+
+	return []DocsOptions{{UI: SwaggerUI, Path: a.openapiDocsURL}}
+}
+
+// registerDocsUIs registers the UIs routes and the embedded assets route
+func registerDocsUIs(a *App, mux *http.ServeMux) {
+	uis := a.docsUIOptions()
+	if len(uis) == 0 {
+		return
+	}
+
+	for _, ui := range uis {
+		page, err := renderDocsUI(a, ui)
+		if err != nil {
+			panic(err)
+		}
+
+		mux.Handle(ui.Path, a.protectDocs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page)
+		})))
+	}
+
+	mux.Handle(a.docsAssetsURL+"/", a.protectDocs(http.StripPrefix(a.docsAssetsURL, docsAssetsHandler())))
+}
+
+func renderDocsUI(a *App, ui DocsOptions) ([]byte, error) {
+	title := ui.Title
+	if title == "" {
+		title = a.title
+	}
+
+	config := make(map[string]interface{})
+	if ui.UI == SwaggerUI {
+		for key, value := range swaggerUIDefaults {
+			config[key] = value
+		}
+	}
+	for key, value := range ui.Config {
+		config[key] = value
+	}
+
+	bundle := docsUIBundles[ui.UI]
+	script, style := ui.ScriptURL, ui.StyleURL
+	if script == "" {
+		script = a.docsAssetsURL + "/" + bundle[0]
+	}
+	if style == "" && bundle[1] != "" {
+		style = a.docsAssetsURL + "/" + bundle[1]
+	}
+
+	var page bytes.Buffer
+	err := docsUITemplates[ui.UI].Execute(&page, map[string]interface{}{
+		"Title":     title,
+		"Script":    script,
+		"Style":     style,
+		"SchemaURL": a.openapiSchemaURL,
+		"Config":    config,
+	})
+
+	return page.Bytes(), err
+}
+
+// docsAssetsHandler serves the embedded UI bundles
+func docsAssetsHandler() http.Handler {
+	assets, _ := fs.Sub(docsUIFiles, "docsui")
+	files := http.FileServer(http.FS(assets))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if !isDocsBundle(name) || !docsAssetEmbedded(name) {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(w, r)
+	})
+}
+
+func isDocsBundle(name string) bool {
+	for _, bundle := range docsUIBundles {
+		if name == bundle[0] || (name == bundle[1] && name != "") {
+			return true
+		}
+	}
+	return false
+}
+
+func docsAssetEmbedded(name string) bool {
+	_, err := fs.Stat(docsUIFiles, "docsui/"+name)
+	return err == nil
+}
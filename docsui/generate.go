@@ -0,0 +1,70 @@
+//go:build ignore
+
+// Downloads the docs UI assets listed in assets.txt, run with "go generate" in the repository root.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	list, err := os.Open(filepath.Join("docsui", "assets.txt"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer list.Close()
+
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			log.Fatalf("invalid asset line: %s", line)
+		}
+
+		if err := download(filepath.Join("docsui", fields[0]), fields[1]); err != nil {
+			log.Fatalf("%s: %s", fields[1], err)
+		}
+		log.Printf("downloaded %s\n", fields[0])
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func download(path string, url string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
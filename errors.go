@@ -0,0 +1,52 @@
+package goapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+	"github.com/hvuhsg/goapi/validators"
+)
+
+// ErrorHandler maps errors returned from views, validation errors and recovered panics to responses.
+type ErrorHandler func(request *request.Request, err error) responses.Response
+
+// PanicError is the error passed to the error handler when a view or external handler panics.
+type PanicError struct {
+	Value     any
+	Stack     []byte
+	RequestID string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// DefaultErrorHandler renders errors as JSON responses.
+//
+// *responses.HTTPError is rendered with its code, message and details,
+// *validators.ValidationError is rendered as 422 with the parameter name in the details,
+// any other error (including panics) is logged and rendered as 500 without exposing the error message.
+func DefaultErrorHandler(request *request.Request, err error) responses.Response {
+	var httpError *responses.HTTPError
+	if errors.As(err, &httpError) {
+		return responses.NewHTTPErrorResponse(httpError)
+	}
+
+	var validationError *validators.ValidationError
+	if errors.As(err, &validationError) {
+		httpError = responses.UnprocessableEntity(validationError.Error()).WithDetails(responses.Json{"parameter": validationError.Parameter})
+		return responses.NewHTTPErrorResponse(httpError)
+	}
+
+	// Panics are already logged with the stack trace by the recovery
+	var panicError *PanicError
+	if !errors.As(err, &panicError) {
+		log.Printf("ERROR: %s\n", err)
+	}
+
+	return responses.NewHTTPErrorResponse(responses.InternalServerError(http.StatusText(http.StatusInternalServerError)))
+}
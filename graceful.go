@@ -0,0 +1,26 @@
+package goapi
+
+import "time"
+
+// GracefulOptions configures RunGraceful.
+type GracefulOptions struct {
+	PIDFile string // Path of the PID file, updated by the new process on restart
+
+	// Max time to wait for in-flight requests on shutdown, default to 30 seconds.
+	DrainTimeout time.Duration
+}
+
+// RunGraceful starts the application over HTTP with zero-downtime restarts.
+//
+// On SIGHUP or SIGUSR2 the binary is started again and inherits the listening socket,
+// once the new process serves, the old process stops accepting connections and drains the in-flight requests.
+// Replace the binary on disk and send SIGHUP to upgrade it, a new process that fails to start leaves the old one serving.
+// SIGTERM and SIGINT drain the requests and stop the server.
+// Restart signals received while the new process starts are ignored. Not supported on Windows, returns an error.
+func (a *App) RunGraceful(host string, port int, options GracefulOptions) error {
+	if options.DrainTimeout == 0 {
+		options.DrainTimeout = 30 * time.Second
+	}
+
+	return a.runGraceful(host, port, options)
+}
@@ -0,0 +1,111 @@
+//go:build !windows
+
+package goapi_test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi"
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+// TestGracefulHelperProcess is the server restarted by TestRunGraceful
+func TestGracefulHelperProcess(t *testing.T) {
+	if os.Getenv("GOAPI_GRACEFUL_HELPER") == "" {
+		t.Skip("helper process")
+	}
+
+	app := goapi.GoAPI("graceful", "1.0")
+	pid := app.Path("/pid")
+	pid.Methods(goapi.GET)
+	pid.Description("pid")
+	pid.Action(func(request *request.Request) responses.Response {
+		if request.HTTPRequest.URL.Query().Has("slow") {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return responses.NewHTMLResponse(strconv.Itoa(os.Getpid()), 200)
+	})
+
+	app.RunGraceful("127.0.0.1", 8092, goapi.GracefulOptions{PIDFile: os.Getenv("GOAPI_GRACEFUL_HELPER")})
+}
+
+func getPID(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestRunGraceful(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGracefulHelperProcess$")
+	cmd.Env = append(os.Environ(), "GOAPI_GRACEFUL_HELPER="+pidFile)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	defer cmd.Process.Kill()
+
+	time.Sleep(500 * time.Millisecond)
+
+	oldPID := strconv.Itoa(cmd.Process.Pid)
+	if data, _ := os.ReadFile(pidFile); strings.TrimSpace(string(data)) != oldPID {
+		t.Fatalf("expecting pid file with %s got '%s'", oldPID, data)
+	}
+
+	// In-flight request is drained by the old process
+	slow := make(chan string)
+	go func() { slow <- getPID(t, "http://127.0.0.1:8092/pid?slow") }()
+	time.Sleep(50 * time.Millisecond)
+
+	// The second signal arrives while the new process starts, only one process takes over
+	cmd.Process.Signal(syscall.SIGHUP)
+	time.Sleep(10 * time.Millisecond)
+	cmd.Process.Signal(syscall.SIGHUP)
+
+	if pid := <-slow; pid != oldPID {
+		t.Errorf("expecting in-flight request to complete on %s got '%s'", oldPID, pid)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("expecting old process to exit after draining got %s", err)
+	}
+
+	newPID := getPID(t, "http://127.0.0.1:8092/pid")
+	if newPID == oldPID {
+		t.Errorf("expecting request to be served by the new process")
+	}
+
+	data, _ := os.ReadFile(pidFile)
+	if strings.TrimSpace(string(data)) != newPID {
+		t.Errorf("expecting pid file with %s got '%s'", newPID, data)
+	}
+
+	pid, _ := strconv.Atoi(newPID)
+	syscall.Kill(pid, syscall.SIGTERM)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Errorf("expecting pid file to be removed on shutdown")
+	}
+
+	if resp, err := http.Get("http://127.0.0.1:8092/pid"); err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		extraPID, _ := strconv.Atoi(string(body))
+		syscall.Kill(extraPID, syscall.SIGTERM)
+		t.Errorf("expecting a single new process got another one with pid %d", extraPID)
+	}
+}
@@ -0,0 +1,180 @@
+//go:build !windows
+
+package goapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	inheritedListenerEnv = "GOAPI_INHERITED_LISTENER"
+	parentPIDEnv         = "GOAPI_PARENT_PID"
+)
+
+// runGraceful serves with the listener handoff on SIGHUP and SIGUSR2
+func (a *App) runGraceful(host string, port int, options GracefulOptions) error {
+	handler, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	listener, err := gracefulListener(addr)
+	if err != nil {
+		return err
+	}
+
+	if options.PIDFile != "" {
+		if err := writePIDFile(options.PIDFile); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	server := &http.Server{Handler: handler}
+	a.startup(addr)
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+
+	// This process accepts the connections now, the parent can drain
+	if parentPID, err := strconv.Atoi(os.Getenv(parentPIDEnv)); err == nil {
+		os.Unsetenv(parentPIDEnv)
+		syscall.Kill(parentPID, syscall.SIGTERM)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR2, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	// Closed when the new process exits, nil when no restart is in progress.
+	// A new process that serves sends SIGTERM to this one.
+	var childExited <-chan struct{}
+
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case <-childExited:
+			childExited = nil
+		case sig := <-signals:
+			if sig == syscall.SIGHUP || sig == syscall.SIGUSR2 {
+				if childExited != nil {
+					log.Printf("graceful restart already in progress, ignoring %s\n", sig)
+					continue
+				}
+
+				exited, err := startChildProcess(listener)
+				if err != nil {
+					log.Printf("graceful restart failed: %s\n", err)
+					continue
+				}
+				childExited = exited
+				continue
+			}
+
+			log.Printf("Draining connections (pid %d)\n", os.Getpid())
+			ctx, cancel := context.WithTimeout(context.Background(), options.DrainTimeout)
+			defer cancel()
+
+			err := server.Shutdown(ctx)
+			if options.PIDFile != "" {
+				removePIDFile(options.PIDFile)
+			}
+			return err
+		}
+	}
+}
+
+// gracefulListener returns the listener inherited from the parent process or a new listener
+func gracefulListener(addr string) (net.Listener, error) {
+	if os.Getenv(inheritedListenerEnv) == "" {
+		return net.Listen("tcp", addr)
+	}
+	os.Unsetenv(inheritedListenerEnv)
+
+	file := os.NewFile(uintptr(systemdFirstFD), "inherited listener")
+	defer file.Close()
+
+	return net.FileListener(file)
+}
+
+// startChildProcess starts the binary again with the listener, the returned channel is closed when the process exits
+func startChildProcess(listener net.Listener) (<-chan struct{}, error) {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("can't pass %T to a new process", listener)
+	}
+
+	file, err := tcpListener.File()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// os.Args[0] and not os.Executable, the binary may have been replaced
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), inheritedListenerEnv+"=1", parentPIDEnv+"="+strconv.Itoa(os.Getpid()))
+	cmd.ExtraFiles = []*os.File{file} // The first extra file is fd 3
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.Printf("Started new process (pid %d)\n", cmd.Process.Pid)
+
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := cmd.Wait(); err != nil {
+			log.Printf("process %d exited: %s\n", cmd.Process.Pid, err)
+		}
+	}()
+
+	return exited, nil
+}
+
+func writePIDFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pid-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	os.Chmod(tmp.Name(), 0644)
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// removePIDFile removes the PID file unless a new process already replaced it
+func removePIDFile(path string) {
+	data, err := os.ReadFile(path)
+	if err == nil && strings.TrimSpace(string(data)) == strconv.Itoa(os.Getpid()) {
+		os.Remove(path)
+	}
+}
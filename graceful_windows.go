@@ -0,0 +1,8 @@
+package goapi
+
+import "errors"
+
+// runGraceful fails, Windows has no signals to trigger the restart and can't pass the listener to a new process.
+func (a *App) runGraceful(host string, port int, options GracefulOptions) error {
+	return errors.New("graceful restarts are not supported on windows")
+}
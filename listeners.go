@@ -0,0 +1,145 @@
+package goapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd socket activation
+const systemdFirstFD = 3
+
+// startupListener logs the listener address, docs URL is logged only for tcp listeners
+func (a *App) startupListener(listener net.Listener) {
+	if listener.Addr().Network() != "tcp" {
+		log.Printf("Starting server at %s:%s\n", listener.Addr().Network(), listener.Addr())
+		return
+	}
+	a.startup(listener.Addr().String())
+}
+
+// Serve serves the application on the listener, use it for listeners created by other libraries.
+func (a *App) Serve(listener net.Listener) error {
+	handler, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	a.startupListener(listener)
+	return http.Serve(listener, handler)
+}
+
+// ServeListeners serves the application on all the listeners concurrently.
+// Returns the first error, the other listeners are closed.
+func (a *App) ServeListeners(listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners to serve")
+	}
+
+	handler, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: handler}
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		a.startupListener(listener)
+		go func(listener net.Listener) { errs <- server.Serve(listener) }(listener)
+	}
+
+	err = <-errs
+	server.Close()
+	return err
+}
+
+// ListenUnix creates Unix domain socket listener at path with the file mode (e.g 0660),
+// the socket is created with the mode so it is never more permissive.
+// A stale socket file from a previous run is removed, the file is removed when the listener is closed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		// Remove only stale sockets, a live server still accepts connections
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use", path)
+		}
+		os.Remove(path)
+	}
+
+	return listenUnix(path, mode)
+}
+
+// RunUnix starts the application on Unix domain socket, used behind reverse proxies on the same host.
+func (a *App) RunUnix(path string, mode os.FileMode) error {
+	listener, err := ListenUnix(path, mode)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	return a.Serve(listener)
+}
+
+// SystemdListeners returns the listeners passed by systemd socket activation (LISTEN_FDS),
+// in the order of the ListenStream entries of the socket unit.
+// Returns no listeners when the process was not socket activated.
+func SystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// The variables must not be inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdFirstFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(systemdFirstFD+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// RunSystemd starts the application on all the sockets passed by systemd socket activation.
+func (a *App) RunSystemd() error {
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return err
+	}
+
+	if len(listeners) == 0 {
+		return errors.New("process was not started by systemd socket activation")
+	}
+
+	log.Printf("Serving %d systemd sockets\n", len(listeners))
+	return a.ServeListeners(listeners...)
+}
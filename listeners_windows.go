@@ -0,0 +1,21 @@
+package goapi
+
+import (
+	"net"
+	"os"
+)
+
+// listenUnix creates the socket and applies the mode, Windows sockets can't be moved into place.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
@@ -2,6 +2,7 @@ package goapi
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/hvuhsg/goapi/middlewares"
 	"github.com/hvuhsg/goapi/request"
@@ -18,14 +19,103 @@ func newMethodsMiddleware(methods []string) middlewares.Middleware {
 	return &methodsMiddleware{Methods: methods}
 }
 
+func (mm *methodsMiddleware) allowsMethod(method string) bool {
+	for _, allowedMethod := range mm.Methods {
+		if allowedMethod == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowHeader returns the value of the Allow header, OPTIONS is always supported
+func (mm *methodsMiddleware) allowHeader() string {
+	methods := mm.Methods
+	if !mm.allowsMethod(http.MethodOptions) {
+		methods = append(methods[:len(methods):len(methods)], http.MethodOptions)
+	}
+
+	return strings.Join(methods, ", ")
+}
+
 func (mm *methodsMiddleware) Apply(next middlewares.AppHandler) middlewares.AppHandler {
 	return func(request *request.Request) responses.Response {
-		for _, method := range mm.Methods {
-			if method == request.HTTPRequest.Method {
-				return next(request)
-			}
+		if mm.allowsMethod(request.HTTPRequest.Method) {
+			return next(request)
 		}
 
-		return responses.NewErrorResponse(http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		// Automatic OPTIONS response for views that did not declare the OPTIONS method
+		if request.HTTPRequest.Method == http.MethodOptions {
+			response := responses.NewResponse(nil, http.StatusNoContent)
+			response.Headers().Set("Allow", mm.allowHeader())
+			return response
+		}
+
+		response := responses.NewErrorResponse(http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		response.Headers().Set("Allow", mm.allowHeader())
+		return response
 	}
 }
+
+// Private middleware that authorizes and validates the requests of the view,
+// runs after the app and view middlewares so rejected requests get their headers.
+type authorizationMiddleware struct {
+	view *View
+}
+
+func newAuthorizationMiddleware(view *View) middlewares.Middleware {
+	return &authorizationMiddleware{view: view}
+}
+
+func (am *authorizationMiddleware) Apply(next middlewares.AppHandler) middlewares.AppHandler {
+	return func(request *request.Request) responses.Response {
+		// OPTIONS requests to views that did not declare the method (CORS preflight included)
+		// are answered by the middlewares, they are not authenticated and have no parameters to validate.
+		if request.HTTPRequest.Method == http.MethodOptions && !am.view.hasMethod(OPTIONS) {
+			return next(request)
+		}
+
+		security, optional := am.view.effectiveSecurity()
+		if err := authorize(security, optional, request); err != nil {
+			return am.view.errorHandler(request, err)
+		}
+
+		// Checked after authentication, requests authenticated by tokens are exempt
+		if response := middlewares.CheckCSRF(request); response != nil {
+			return response
+		}
+
+		if isValid, err := am.view.isValidRequest(request); !isValid {
+			return am.view.errorHandler(request, err)
+		}
+
+		response := next(request)
+
+		// The cache middleware runs before authentication, responses of secured views must not be shared
+		if response != nil && len(security) > 0 && !optional {
+			markPrivate(response.Headers())
+		}
+
+		return response
+	}
+}
+
+// markPrivate adds the private Cache-Control directive unless the response is explicitly shared or not stored
+func markPrivate(headers http.Header) {
+	if headers == nil {
+		return
+	}
+
+	for _, value := range headers.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(name) {
+			case "public", "s-maxage", "private", "no-store":
+				return
+			}
+		}
+	}
+
+	headers.Add("Cache-Control", "private")
+}
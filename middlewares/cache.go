@@ -1,47 +1,351 @@
 package middlewares
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hvuhsg/goapi/request"
 	"github.com/hvuhsg/goapi/responses"
-	"github.com/patrickmn/go-cache"
 )
 
+// CacheOptions configures the CacheMiddleware.
+type CacheOptions struct {
+	// Where the responses are stored, defaults to an in-memory backend.
+	Backend CacheBackend
+
+	// Freshness lifetime of responses without Cache-Control max-age or Expires headers.
+	// Zero means such responses are not cached.
+	DefaultExpiration time.Duration
+
+	// Prefix for all the cache keys, useful when the backend is shared between apps.
+	KeyPrefix string
+
+	// How long stale responses with validators (ETag / Last-Modified) are kept for conditional revalidation.
+	StaleTTL time.Duration
+
+	// Tags attached to the cached response, used with InvalidateTag.
+	// Tags can also be set by the view using the "Cache-Tag" response header (comma separated).
+	Tags func(request *request.Request) []string
+}
+
+// CacheMiddleware is a shared HTTP cache for GET and HEAD requests, HEAD requests are served from the GET responses.
+//
+// The cache honours the Cache-Control (no-store, no-cache, private, max-age, s-maxage) and Expires headers,
+// keeps a separate entry for every combination of the headers listed in the Vary response header,
+// revalidates stale responses with If-None-Match / If-Modified-Since and answers conditional requests with 304.
+// Responses with Set-Cookie are never stored, responses to requests with Authorization or Cookie
+// are stored only with Cache-Control public or s-maxage.
+// Successful unsafe requests (POST, PUT, ...) invalidate the cached responses of their path.
 type CacheMiddleware struct {
-	cache     *cache.Cache
-	keyPrefix string
+	options CacheOptions
 }
 
 func NewCacheMiddleware(expiration time.Duration, keyPrefix string) *CacheMiddleware {
-	return &CacheMiddleware{
-		cache:     cache.New(expiration, time.Minute),
-		keyPrefix: keyPrefix,
+	return NewCacheMiddlewareWithOptions(CacheOptions{DefaultExpiration: expiration, KeyPrefix: keyPrefix})
+}
+
+func NewCacheMiddlewareWithOptions(options CacheOptions) *CacheMiddleware {
+	if options.Backend == nil {
+		options.Backend = NewMemoryCacheBackend(time.Minute)
 	}
+
+	return &CacheMiddleware{options: options}
+}
+
+// InvalidateTag removes all the cached responses with the tag.
+func (cm *CacheMiddleware) InvalidateTag(tag string) {
+	cm.options.Backend.InvalidateTag(cm.options.KeyPrefix + "tag:" + tag)
+}
+
+// InvalidatePath removes all the cached responses of the path (for any query string and variant).
+func (cm *CacheMiddleware) InvalidatePath(path string) {
+	cm.options.Backend.InvalidateTag(cm.options.KeyPrefix + "path:" + path)
+}
+
+// cachedResponse is the serialized form of a response stored in the backend
+type cachedResponse struct {
+	Code       int         `json:"code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+	FreshUntil time.Time   `json:"fresh_until"`
+}
+
+// cacheIndex lists the request headers that select the response variant
+type cacheIndex struct {
+	Vary []string `json:"vary"`
+}
+
+func (cr *cachedResponse) isFresh() bool {
+	return time.Now().Before(cr.FreshUntil)
+}
+
+func (cr *cachedResponse) hasValidators() bool {
+	return cr.Header.Get("ETag") != "" || cr.Header.Get("Last-Modified") != ""
+}
+
+func (cr *cachedResponse) toResponse(request *request.Request) responses.Response {
+	code := cr.Code
+	body := cr.Body
+
+	if isNotModified(request.HTTPRequest, cr.Header) {
+		code = http.StatusNotModified
+		body = nil
+	}
+
+	response := responses.NewResponse(body, code)
+	for k, values := range cr.Header {
+		for _, value := range values {
+			response.Headers().Add(k, value)
+		}
+	}
+	response.Headers().Set("Age", strconv.Itoa(int(time.Since(cr.StoredAt).Seconds())))
+
+	return response
 }
 
 func (cm *CacheMiddleware) Apply(next AppHandler) AppHandler {
 	return func(request *request.Request) responses.Response {
-		// Generate a cache key from the request URL
-		cacheKey := cm.keyPrefix + request.HTTPRequest.URL.String()
-
-		// Check if the response is already in the cache
-		cachedResponse, found := cm.cache.Get(cacheKey)
-		if found {
-			response := cachedResponse.(responses.Response)
-			// If the response is in the cache, return it directly
+		r := request.HTTPRequest
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			response := next(request)
+
+			// Unsafe methods change the resource, cached representations are outdated
+			if response.StatusCode() < http.StatusBadRequest {
+				cm.InvalidatePath(r.URL.Path)
+			}
+
 			return response
 		}
 
-		// Call the next middleware or handler
-		response := next(request)
+		requestDirectives := parseCacheControl(r.Header.Values("Cache-Control"))
+		if _, noStore := requestDirectives["no-store"]; noStore {
+			return next(request)
+		}
+
+		primaryKey := cm.options.KeyPrefix + "GET " + r.URL.String()
+		cached := cm.load(primaryKey, request)
+
+		_, noCache := requestDirectives["no-cache"]
+		if cached != nil && !noCache && cached.isFresh() {
+			return cached.toResponse(request)
+		}
 
-		// If the response status code is 200 OK, cache the response
-		if response.StatusCode() == http.StatusOK {
-			cm.cache.Set(cacheKey, response, cache.DefaultExpiration)
+		if cached != nil && cached.hasValidators() {
+			return cm.revalidate(next, request, primaryKey, cached)
 		}
 
+		response := next(request)
+		cm.store(request, primaryKey, response)
 		return response
 	}
 }
+
+// revalidate asks the view if the stale response is still valid using a conditional request
+func (cm *CacheMiddleware) revalidate(next AppHandler, req *request.Request, primaryKey string, cached *cachedResponse) responses.Response {
+	conditional := *req
+	conditional.HTTPRequest = req.HTTPRequest.Clone(req.HTTPRequest.Context())
+	conditional.HTTPRequest.Header.Del("If-Modified-Since")
+	conditional.HTTPRequest.Header.Del("If-None-Match")
+
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		conditional.HTTPRequest.Header.Set("If-None-Match", etag)
+	} else {
+		conditional.HTTPRequest.Header.Set("If-Modified-Since", cached.Header.Get("Last-Modified"))
+	}
+
+	response := next(&conditional)
+	if response.StatusCode() != http.StatusNotModified {
+		cm.store(req, primaryKey, response)
+		return response
+	}
+
+	// Still valid, update the stored headers with the 304 response headers
+	for k, values := range response.Headers() {
+		cached.Header[k] = values
+	}
+
+	refreshed := responses.NewResponse(cached.Body, cached.Code)
+	for k, values := range cached.Header {
+		refreshed.Headers()[k] = values
+	}
+	cm.store(req, primaryKey, refreshed)
+
+	cached.StoredAt = time.Now()
+	return cached.toResponse(req)
+}
+
+func (cm *CacheMiddleware) load(primaryKey string, request *request.Request) *cachedResponse {
+	indexBytes, found := cm.options.Backend.Get(primaryKey)
+	if !found {
+		return nil
+	}
+
+	var index cacheIndex
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil
+	}
+
+	entryBytes, found := cm.options.Backend.Get(variantKey(primaryKey, index.Vary, request.HTTPRequest))
+	if !found {
+		return nil
+	}
+
+	cached := new(cachedResponse)
+	if err := json.Unmarshal(entryBytes, cached); err != nil {
+		return nil
+	}
+
+	return cached
+}
+
+func (cm *CacheMiddleware) store(request *request.Request, primaryKey string, response responses.Response) {
+	// HEAD responses have no body, HEAD requests are served from the GET entry
+	if request.HTTPRequest.Method != http.MethodGet || response.StatusCode() != http.StatusOK {
+		return
+	}
+
+	headers := response.Headers()
+	directives := parseCacheControl(headers.Values("Cache-Control"))
+
+	_, noStore := directives["no-store"]
+	_, private := directives["private"]
+	if noStore || private {
+		return
+	}
+
+	// Cookies are per client, replaying them hands the session to everyone
+	if headers.Get("Set-Cookie") != "" {
+		return
+	}
+
+	// Authenticated responses (Authorization or Cookie) are only stored when explicitly allowed
+	_, public := directives["public"]
+	_, sharedMaxAge := directives["s-maxage"]
+	authenticated := request.HTTPRequest.Header.Get("Authorization") != "" || request.HTTPRequest.Header.Get("Cookie") != ""
+	if authenticated && !public && !sharedMaxAge {
+		return
+	}
+
+	vary := make([]string, 0)
+	for _, value := range headers.Values("Vary") {
+		vary = append(vary, parseHeaderList(value)...)
+	}
+	for _, header := range vary {
+		if header == "*" {
+			return
+		}
+	}
+
+	now := time.Now()
+	entry := &cachedResponse{
+		Code:       response.StatusCode(),
+		Header:     headers.Clone(),
+		Body:       response.ToBytes(),
+		StoredAt:   now,
+		FreshUntil: now.Add(cm.freshness(directives, headers, now)),
+	}
+
+	ttl := entry.FreshUntil.Sub(now)
+	if entry.hasValidators() {
+		ttl += cm.options.StaleTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	indexBytes, err := json.Marshal(cacheIndex{Vary: vary})
+	if err != nil {
+		return
+	}
+
+	tags := cm.tags(request, headers)
+	cm.options.Backend.Set(primaryKey, indexBytes, ttl, tags)
+	cm.options.Backend.Set(variantKey(primaryKey, vary, request.HTTPRequest), entryBytes, ttl, tags)
+}
+
+// freshness calculates the freshness lifetime of the response (RFC 9111 section 4.2.1)
+func (cm *CacheMiddleware) freshness(directives map[string]string, headers http.Header, now time.Time) time.Duration {
+	if _, noCache := directives["no-cache"]; noCache {
+		return 0
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[directive]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	if expires := headers.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return expiresAt.Sub(now)
+	}
+
+	return cm.options.DefaultExpiration
+}
+
+func (cm *CacheMiddleware) tags(request *request.Request, headers http.Header) []string {
+	tags := []string{"path:" + request.HTTPRequest.URL.Path}
+
+	if cm.options.Tags != nil {
+		for _, tag := range cm.options.Tags(request) {
+			tags = append(tags, "tag:"+tag)
+		}
+	}
+
+	for _, value := range headers.Values("Cache-Tag") {
+		for _, tag := range parseHeaderList(value) {
+			tags = append(tags, "tag:"+tag)
+		}
+	}
+
+	for i := range tags {
+		tags[i] = cm.options.KeyPrefix + tags[i]
+	}
+
+	return tags
+}
+
+// variantKey builds the key of the response variant from the values of the vary headers
+func variantKey(primaryKey string, vary []string, r *http.Request) string {
+	var key strings.Builder
+	key.WriteString(primaryKey)
+
+	for _, header := range vary {
+		key.WriteString("\n")
+		key.WriteString(http.CanonicalHeaderKey(header))
+		key.WriteString(": ")
+		key.WriteString(strings.Join(r.Header.Values(header), ", "))
+	}
+
+	return key.String()
+}
+
+// parseCacheControl parse the Cache-Control header values into a directive -> argument map
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+
+	for _, value := range values {
+		for _, directive := range parseHeaderList(value) {
+			name, argument, _ := strings.Cut(directive, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(argument), "\"")
+		}
+	}
+
+	return directives
+}
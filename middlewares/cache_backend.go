@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// CacheBackend stores the serialized responses of the CacheMiddleware.
+//
+// Values are opaque bytes so the backend can be shared between replicas (redis, memcached, ...).
+// Tags are used for explicit invalidation, the backend should forget the tags of expired keys.
+type CacheBackend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration, tags []string)
+	Delete(key string)
+	InvalidateTag(tag string)
+}
+
+type memoryCacheBackend struct {
+	cache *cache.Cache
+	lock  sync.Mutex
+	tags  map[string]map[string]struct{} // tag -> keys
+	keys  map[string][]string            // key -> tags
+}
+
+// Create in-memory cache backend, expired entries are removed every cleanupInterval.
+func NewMemoryCacheBackend(cleanupInterval time.Duration) CacheBackend {
+	mb := &memoryCacheBackend{
+		cache: cache.New(cache.NoExpiration, cleanupInterval),
+		tags:  make(map[string]map[string]struct{}),
+		keys:  make(map[string][]string),
+	}
+	mb.cache.OnEvicted(func(key string, _ interface{}) { mb.untag(key) })
+
+	return mb
+}
+
+func (mb *memoryCacheBackend) Get(key string) ([]byte, bool) {
+	value, found := mb.cache.Get(key)
+	if !found {
+		return nil, false
+	}
+
+	return value.([]byte), true
+}
+
+func (mb *memoryCacheBackend) Set(key string, value []byte, ttl time.Duration, tags []string) {
+	mb.untag(key)
+
+	mb.lock.Lock()
+	for _, tag := range tags {
+		keys, ok := mb.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			mb.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	mb.keys[key] = tags
+	mb.lock.Unlock()
+
+	mb.cache.Set(key, value, ttl)
+}
+
+func (mb *memoryCacheBackend) Delete(key string) {
+	mb.cache.Delete(key)
+	mb.untag(key)
+}
+
+func (mb *memoryCacheBackend) InvalidateTag(tag string) {
+	mb.lock.Lock()
+	keys := make([]string, 0, len(mb.tags[tag]))
+	for key := range mb.tags[tag] {
+		keys = append(keys, key)
+	}
+	mb.lock.Unlock()
+
+	// Delete outside of the lock, the eviction callback locks too
+	for _, key := range keys {
+		mb.Delete(key)
+	}
+}
+
+func (mb *memoryCacheBackend) untag(key string) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	for _, tag := range mb.keys[key] {
+		delete(mb.tags[tag], key)
+		if len(mb.tags[tag]) == 0 {
+			delete(mb.tags, tag)
+		}
+	}
+	delete(mb.keys, key)
+}
@@ -0,0 +1,176 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+func newCountingHandler(headers map[string]string) (AppHandler, *int) {
+	calls := 0
+	handler := func(request *request.Request) responses.Response {
+		calls++
+		response := responses.NewHTMLResponse(fmt.Sprintf("call %d", calls), http.StatusOK)
+		for k, v := range headers {
+			response.Headers().Set(k, v)
+		}
+		return response
+	}
+	return handler, &calls
+}
+
+func cacheRequest(method string, url string, headers map[string]string) *request.Request {
+	httpRequest := httptest.NewRequest(method, url, nil)
+	for k, v := range headers {
+		httpRequest.Header.Set(k, v)
+	}
+	return request.NewRequest(httpRequest)
+}
+
+func TestCacheMiddlewareHonoursCacheControl(t *testing.T) {
+	cm := NewCacheMiddleware(time.Minute, "test:")
+
+	handler, calls := newCountingHandler(nil)
+	cached := cm.Apply(handler)
+	cached(cacheRequest(http.MethodGet, "/a", nil))
+	response := cached(cacheRequest(http.MethodGet, "/a", nil))
+	if *calls != 1 || string(response.ToBytes()) != "call 1" {
+		t.Errorf("expecting second request to be served from cache, view called %d times", *calls)
+	}
+
+	handler, calls = newCountingHandler(map[string]string{"Cache-Control": "no-store"})
+	notStored := cm.Apply(handler)
+	notStored(cacheRequest(http.MethodGet, "/b", nil))
+	notStored(cacheRequest(http.MethodGet, "/b", nil))
+	if *calls != 2 {
+		t.Errorf("expecting no-store responses not to be cached, view called %d times", *calls)
+	}
+
+	handler, calls = newCountingHandler(nil)
+	postHandler := cm.Apply(handler)
+	postHandler(cacheRequest(http.MethodPost, "/c", nil))
+	postHandler(cacheRequest(http.MethodPost, "/c", nil))
+	if *calls != 2 {
+		t.Errorf("expecting POST requests not to be cached, view called %d times", *calls)
+	}
+}
+
+func TestCacheMiddlewareVary(t *testing.T) {
+	cm := NewCacheMiddleware(time.Minute, "")
+	handler, calls := newCountingHandler(map[string]string{"Vary": "Accept-Language"})
+	cached := cm.Apply(handler)
+
+	cached(cacheRequest(http.MethodGet, "/", map[string]string{"Accept-Language": "en"}))
+	cached(cacheRequest(http.MethodGet, "/", map[string]string{"Accept-Language": "he"}))
+	cached(cacheRequest(http.MethodGet, "/", map[string]string{"Accept-Language": "en"}))
+
+	if *calls != 2 {
+		t.Errorf("expecting a cached variant per language, view called %d times", *calls)
+	}
+}
+
+func TestCacheMiddlewareConditional(t *testing.T) {
+	cm := NewCacheMiddlewareWithOptions(CacheOptions{StaleTTL: time.Minute})
+
+	calls := 0
+	handler := func(request *request.Request) responses.Response {
+		calls++
+		if request.HTTPRequest.Header.Get("If-None-Match") == `"v1"` {
+			return responses.NewResponse(nil, http.StatusNotModified)
+		}
+		response := responses.NewHTMLResponse("content", http.StatusOK)
+		response.Headers().Set("ETag", `"v1"`)
+		response.Headers().Set("Cache-Control", "no-cache")
+		return response
+	}
+	cached := cm.Apply(handler)
+
+	cached(cacheRequest(http.MethodGet, "/", nil))
+	response := cached(cacheRequest(http.MethodGet, "/", nil))
+	if calls != 2 || response.StatusCode() != http.StatusOK || string(response.ToBytes()) != "content" {
+		t.Errorf("expecting stale response to be revalidated and served from cache")
+	}
+
+	response = cached(cacheRequest(http.MethodGet, "/", map[string]string{"If-None-Match": `W/"v1"`}))
+	if response.StatusCode() != http.StatusNotModified {
+		t.Errorf("expecting status-code 304 got %d", response.StatusCode())
+	}
+}
+
+func TestCacheMiddlewareInvalidation(t *testing.T) {
+	cm := NewCacheMiddlewareWithOptions(CacheOptions{
+		DefaultExpiration: time.Minute,
+		Tags:              func(request *request.Request) []string { return []string{"users"} },
+	})
+	handler, calls := newCountingHandler(nil)
+	cached := cm.Apply(handler)
+
+	cached(cacheRequest(http.MethodGet, "/users?page=1", nil))
+	cm.InvalidateTag("users")
+	cached(cacheRequest(http.MethodGet, "/users?page=1", nil))
+	if *calls != 2 {
+		t.Errorf("expecting tag invalidation to remove the response, view called %d times", *calls)
+	}
+
+	cm.InvalidatePath("/users")
+	cached(cacheRequest(http.MethodGet, "/users?page=1", nil))
+	if *calls != 3 {
+		t.Errorf("expecting path invalidation to remove the response, view called %d times", *calls)
+	}
+}
+
+func TestCacheMiddlewarePrivacy(t *testing.T) {
+	cm := NewCacheMiddleware(time.Minute, "")
+
+	handler, calls := newCountingHandler(map[string]string{"Set-Cookie": "session=alice"})
+	cached := cm.Apply(handler)
+	cached(cacheRequest(http.MethodGet, "/login", nil))
+	response := cached(cacheRequest(http.MethodGet, "/login", nil))
+	if *calls != 2 || response.Headers().Get("Set-Cookie") != "session=alice" || string(response.ToBytes()) != "call 2" {
+		t.Errorf("expecting responses with Set-Cookie not to be cached, view called %d times", *calls)
+	}
+
+	handler, calls = newCountingHandler(nil)
+	cached = cm.Apply(handler)
+	cached(cacheRequest(http.MethodGet, "/profile", map[string]string{"Cookie": "session=alice"}))
+	cached(cacheRequest(http.MethodGet, "/profile", nil))
+	if *calls != 2 {
+		t.Errorf("expecting responses to requests with cookies not to be cached, view called %d times", *calls)
+	}
+
+	handler, calls = newCountingHandler(map[string]string{"Cache-Control": "public, max-age=60"})
+	cached = cm.Apply(handler)
+	cached(cacheRequest(http.MethodGet, "/news", map[string]string{"Cookie": "theme=dark"}))
+	cached(cacheRequest(http.MethodGet, "/news", nil))
+	if *calls != 1 {
+		t.Errorf("expecting public responses to be cached, view called %d times", *calls)
+	}
+}
+
+func TestCacheMiddlewareHead(t *testing.T) {
+	cm := NewCacheMiddleware(time.Minute, "")
+
+	calls := 0
+	cached := cm.Apply(func(request *request.Request) responses.Response {
+		calls++
+		if request.HTTPRequest.Method == http.MethodHead {
+			return responses.NewHTMLResponse("", http.StatusOK)
+		}
+		return responses.NewHTMLResponse("body", http.StatusOK)
+	})
+
+	cached(cacheRequest(http.MethodHead, "/", nil))
+	if body := string(cached(cacheRequest(http.MethodGet, "/", nil)).ToBytes()); body != "body" {
+		t.Errorf("expecting HEAD response not to be served for GET got '%s'", body)
+	}
+
+	cached(cacheRequest(http.MethodHead, "/", nil))
+	if calls != 2 {
+		t.Errorf("expecting HEAD request to be served from the GET entry, view called %d times", calls)
+	}
+}
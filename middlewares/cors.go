@@ -2,60 +2,195 @@ package middlewares
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hvuhsg/goapi/request"
 	"github.com/hvuhsg/goapi/responses"
 )
 
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// Origins allowed to make cross-origin requests.
+	// Supports "*" for any origin and a single wildcard subdomain like "https://*.example.com".
+	AllowedOrigins []string
+
+	// Methods allowed in preflight requests, defaults to GET, HEAD and POST.
+	AllowedMethods []string
+
+	// Request headers allowed in preflight requests, "*" allows any header.
+	AllowedHeaders []string
+
+	// Response headers the browser is allowed to expose to the client script.
+	ExposedHeaders []string
+
+	// Allow cookies and authorization headers in cross-origin requests.
+	AllowCredentials bool
+
+	// How long the browser may cache the preflight response, zero means no Access-Control-Max-Age header.
+	MaxAge time.Duration
+}
+
 type corsMiddleware struct {
-	allowedOrigins []string
-	allowedMethods []string
-	allowedHeaders []string
+	options CORSOptions
 }
 
-// Creates a new CORS middleware that allows requests from any origin (using the * character)
+// Creates a new CORS middleware that allows requests from the given origins (use "*" to allow any origin)
 // and with the specified HTTP methods and headers.
 func NewCORSMiddleware(allowedOrigins, allowedMethods, allowedHeaders []string) Middleware {
-	return &corsMiddleware{
-		allowedOrigins: allowedOrigins,
-		allowedMethods: allowedMethods,
-		allowedHeaders: allowedHeaders,
+	return NewCORSMiddlewareWithOptions(CORSOptions{
+		AllowedOrigins: allowedOrigins,
+		AllowedMethods: allowedMethods,
+		AllowedHeaders: allowedHeaders,
+	})
+}
+
+// Creates a new CORS middleware with full control over the CORS options.
+//
+// Preflight requests (OPTIONS with Access-Control-Request-Method) are answered by the middleware,
+// any other request is passed to the view and the CORS headers are added to its response.
+// Requests without an Origin header are not cross-origin requests and are passed as is.
+func NewCORSMiddlewareWithOptions(options CORSOptions) Middleware {
+	if len(options.AllowedMethods) == 0 {
+		options.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
 	}
+
+	return &corsMiddleware{options: options}
 }
 
 func (cm *corsMiddleware) originIsAllowed(origin string) bool {
-	for _, allowedOrigin := range cm.allowedOrigins {
+	for _, allowedOrigin := range cm.options.AllowedOrigins {
 		if allowedOrigin == "*" || allowedOrigin == origin {
 			return true
 		}
+
+		// Wildcard subdomain (https://*.example.com)
+		if prefix, suffix, found := strings.Cut(allowedOrigin, "*"); found {
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
 	}
 
 	return false
 }
 
-func (cm corsMiddleware) Apply(next AppHandler) AppHandler {
-	return func(request *request.Request) responses.Response {
-		isOptionsMethod := request.HTTPRequest.Method == http.MethodOptions
-		isGetMethod := request.HTTPRequest.Method == http.MethodGet
-
-		if isOptionsMethod || isGetMethod {
-			if cm.originIsAllowed(request.HTTPRequest.Header.Get("Origin")) {
-				response := responses.NewHTMLResponse("", http.StatusOK)
-				response.Headers().Set("Access-Control-Allow-Origin", request.HTTPRequest.Header.Get("Origin"))
-				response.Headers().Set("Access-Control-Allow-Methods", strings.Join(cm.allowedMethods, ", "))
-				response.Headers().Set("Access-Control-Allow-Headers", strings.Join(cm.allowedHeaders, ", "))
-				return response
-			} else {
-				response := responses.NewErrorResponse(http.StatusText(http.StatusForbidden), http.StatusForbidden)
-				return response
+func (cm *corsMiddleware) methodIsAllowed(method string) bool {
+	for _, allowedMethod := range cm.options.AllowedMethods {
+		if strings.EqualFold(allowedMethod, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cm *corsMiddleware) headersAreAllowed(headers []string) bool {
+	for _, header := range headers {
+		allowed := false
+		for _, allowedHeader := range cm.options.AllowedHeaders {
+			if allowedHeader == "*" || strings.EqualFold(allowedHeader, header) {
+				allowed = true
+				break
 			}
 		}
 
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for an allowed origin
+func (cm *corsMiddleware) allowOrigin(origin string) string {
+	// The "*" value is not allowed with credentials, so the origin is reflected
+	if !cm.options.AllowCredentials {
+		for _, allowedOrigin := range cm.options.AllowedOrigins {
+			if allowedOrigin == "*" {
+				return "*"
+			}
+		}
+	}
+
+	return origin
+}
+
+func (cm *corsMiddleware) preflight(request *request.Request) responses.Response {
+	origin := request.HTTPRequest.Header.Get("Origin")
+	requestedMethod := request.HTTPRequest.Header.Get("Access-Control-Request-Method")
+	requestedHeaders := parseHeaderList(request.HTTPRequest.Header.Get("Access-Control-Request-Headers"))
+
+	if !cm.originIsAllowed(origin) || !cm.methodIsAllowed(requestedMethod) || !cm.headersAreAllowed(requestedHeaders) {
+		response := responses.NewErrorResponse(http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		response.Headers().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+		return response
+	}
+
+	response := responses.NewResponse(nil, http.StatusNoContent)
+	headers := response.Headers()
+	headers.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	headers.Set("Access-Control-Allow-Origin", cm.allowOrigin(origin))
+	headers.Set("Access-Control-Allow-Methods", strings.Join(cm.options.AllowedMethods, ", "))
+
+	if len(requestedHeaders) > 0 {
+		headers.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+
+	if cm.options.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if cm.options.MaxAge > 0 {
+		headers.Set("Access-Control-Max-Age", strconv.Itoa(int(cm.options.MaxAge.Seconds())))
+	}
+
+	return response
+}
+
+func (cm *corsMiddleware) Apply(next AppHandler) AppHandler {
+	return func(request *request.Request) responses.Response {
+		origin := request.HTTPRequest.Header.Get("Origin")
+		isPreflight := request.HTTPRequest.Method == http.MethodOptions && request.HTTPRequest.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin != "" && isPreflight {
+			return cm.preflight(request)
+		}
+
 		response := next(request)
-		response.Headers().Set("Access-Control-Allow-Origin", request.HTTPRequest.Header.Get("Origin"))
-		response.Headers().Set("Access-Control-Allow-Methods", strings.Join(cm.allowedMethods, ", "))
-		response.Headers().Set("Access-Control-Allow-Headers", strings.Join(cm.allowedHeaders, ", "))
+
+		// The response depends on the origin, caches must not share it between origins
+		response.Headers().Add("Vary", "Origin")
+
+		if origin == "" || !cm.originIsAllowed(origin) {
+			return response
+		}
+
+		headers := response.Headers()
+		headers.Set("Access-Control-Allow-Origin", cm.allowOrigin(origin))
+
+		if cm.options.AllowCredentials {
+			headers.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if len(cm.options.ExposedHeaders) > 0 {
+			headers.Set("Access-Control-Expose-Headers", strings.Join(cm.options.ExposedHeaders, ", "))
+		}
+
 		return response
 	}
 }
+
+// parseHeaderList splits comma separated header value into trimmed non empty items
+func parseHeaderList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
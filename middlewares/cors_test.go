@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+)
+
+func corsRequest(method string, headers map[string]string) *request.Request {
+	httpRequest := httptest.NewRequest(method, "/", nil)
+	for k, v := range headers {
+		httpRequest.Header.Set(k, v)
+	}
+	return request.NewRequest(httpRequest)
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	handler := NewCORSMiddlewareWithOptions(CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+	}).Apply(okHandler)
+
+	response := handler(corsRequest(http.MethodGet, map[string]string{"Origin": "https://app.example.com"}))
+	if string(response.ToBytes()) != "ok" {
+		t.Errorf("expecting the view to handle GET requests")
+	}
+	if got := response.Headers().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("expecting origin to be reflected got '%s'", got)
+	}
+	if got := response.Headers().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("expecting credentials to be allowed got '%s'", got)
+	}
+	if got := response.Headers().Get("Access-Control-Expose-Headers"); got != "X-Total" {
+		t.Errorf("expecting exposed headers got '%s'", got)
+	}
+	if got := response.Headers().Get("Vary"); got != "Origin" {
+		t.Errorf("expecting 'Vary: Origin' got '%s'", got)
+	}
+
+	response = handler(corsRequest(http.MethodGet, map[string]string{"Origin": "https://example.com"}))
+	if response.StatusCode() != http.StatusOK || response.Headers().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expecting disallowed origin to get the response without CORS headers")
+	}
+
+	response = handler(corsRequest(http.MethodGet, nil))
+	if response.StatusCode() != http.StatusOK || response.Headers().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expecting same-origin request to pass without CORS headers")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler := NewCORSMiddlewareWithOptions(CORSOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         10 * time.Minute,
+	}).Apply(okHandler)
+
+	response := handler(corsRequest(http.MethodOptions, map[string]string{
+		"Origin":                         "https://other.com",
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "content-type",
+	}))
+
+	if response.StatusCode() != http.StatusNoContent {
+		t.Errorf("expecting status-code 204 got %d", response.StatusCode())
+	}
+	if got := response.Headers().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expecting '*' allowed origin got '%s'", got)
+	}
+	if got := response.Headers().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("expecting max-age 600 got '%s'", got)
+	}
+
+	response = handler(corsRequest(http.MethodOptions, map[string]string{
+		"Origin":                         "https://other.com",
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "X-Secret",
+	}))
+
+	if response.StatusCode() != http.StatusForbidden {
+		t.Errorf("expecting disallowed header to be rejected got %d", response.StatusCode())
+	}
+}
@@ -0,0 +1,359 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+const csrfTokenLength = 32
+
+// CSRFMode selects how the CSRF token is kept between requests.
+type CSRFMode int
+
+const (
+	// CSRFDoubleSubmit keeps the token in a cookie, the request must send the same token in the header or form field.
+	// The cookie is readable by scripts, so single page apps can copy it into the header.
+	CSRFDoubleSubmit CSRFMode = iota
+
+	// CSRFSynchronizer keeps the token in the session, requires the SessionMiddleware to run before the CSRFMiddleware.
+	CSRFSynchronizer
+)
+
+// CSRFOptions configures the CSRFMiddleware.
+type CSRFOptions struct {
+	Mode CSRFMode
+
+	CookieName string        // Cookie of CSRFDoubleSubmit mode, default to "csrf_token"
+	Path       string        // default to "/"
+	Domain     string        // Cookie domain, default to the request host
+	Secure     bool          // Send the cookie only over https
+	SameSite   http.SameSite // default to http.SameSiteLaxMode
+
+	HeaderName string // Header with the token, default to "X-CSRF-Token"
+	FieldName  string // Form field with the token, default to "csrf_token"
+
+	// Origins allowed to send unsafe requests besides the origin of the app (e.g https://admin.example.com).
+	TrustedOrigins []string
+
+	// Requests to skip. Requests authenticated by app security providers that the browser
+	// doesn't send automatically (bearer tokens, API keys in header) are always skipped.
+	Exempt func(request *request.Request) bool
+
+	// Response returned when the check fails, defaults to 403 error.
+	FailureResponse func(request *request.Request, reason string) responses.Response
+}
+
+// CSRFMiddleware protects views that use cookie based authentication (sessions) from cross-site request forgery.
+//
+// Unsafe requests (POST, PUT, PATCH, DELETE, ...) must come from a trusted Origin (or Referer)
+// and carry the CSRF token. Views get the token with CSRFToken, template responses with
+// the csrfToken and csrfField template functions:
+//
+//	<form method="post">{{ csrfField }} ...</form>
+type CSRFMiddleware struct {
+	options CSRFOptions
+}
+
+var (
+	csrfTokenKey  = request.NewKey[string]("csrf-token")
+	csrfExemptKey = request.NewKey[bool]("csrf-exempt")
+	csrfDeferKey  = request.NewKey[bool]("csrf-defer")
+	csrfCheckKey  = request.NewKey[func() responses.Response]("csrf-check")
+)
+
+func NewCSRFMiddleware(options CSRFOptions) *CSRFMiddleware {
+	if options.CookieName == "" {
+		options.CookieName = "csrf_token"
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if options.SameSite == 0 {
+		options.SameSite = http.SameSiteLaxMode
+	}
+	if options.HeaderName == "" {
+		options.HeaderName = "X-CSRF-Token"
+	}
+	if options.FieldName == "" {
+		options.FieldName = "csrf_token"
+	}
+	if options.FailureResponse == nil {
+		options.FailureResponse = func(_ *request.Request, reason string) responses.Response {
+			return responses.NewHTTPErrorResponse(responses.Forbidden("CSRF check failed: " + reason))
+		}
+	}
+
+	return &CSRFMiddleware{options: options}
+}
+
+// ExemptFromCSRF marks the request as not subject to CSRF checks,
+// used by authentication that the browser doesn't send automatically.
+func ExemptFromCSRF(r *request.Request) {
+	request.SetValue(r, csrfExemptKey, true)
+}
+
+// DeferCSRF makes the CSRFMiddleware leave the check of the request to CheckCSRF,
+// so the check runs after authentication and requests exempted by it pass.
+func DeferCSRF(r *request.Request) {
+	request.SetValue(r, csrfDeferKey, true)
+}
+
+// CheckCSRF runs the check deferred by DeferCSRF, returns the failure response or nil when the request passes.
+func CheckCSRF(r *request.Request) responses.Response {
+	check, ok := request.GetValue(r, csrfCheckKey)
+	if !ok || check == nil {
+		return nil
+	}
+
+	request.SetValue(r, csrfCheckKey, nil)
+	return check()
+}
+
+// CSRFToken returns the masked CSRF token of the request, send it back in the header or form field.
+// The token is masked differently on every call, so it doesn't leak through compressed responses.
+func CSRFToken(r *request.Request) string {
+	token, ok := request.GetValue(r, csrfTokenKey)
+	if !ok {
+		return ""
+	}
+
+	return maskCSRFToken([]byte(token))
+}
+
+func (cm *CSRFMiddleware) Apply(next AppHandler) AppHandler {
+	return func(request *request.Request) responses.Response {
+		if isCSRFExempt(request) || (cm.options.Exempt != nil && cm.options.Exempt(request)) {
+			// Templates shared with checked views still call the functions
+			response := next(request)
+			if tr, ok := response.(responses.TemplateResponse); ok {
+				tr.Funcs(template.FuncMap{
+					"csrfToken": func() string { return "" },
+					"csrfField": func() string { return "" },
+				})
+			}
+			return response
+		}
+
+		token, isNew, err := cm.loadToken(request)
+		if err != nil {
+			log.Printf("csrf: %s\n", err)
+			return responses.NewHTTPErrorResponse(responses.InternalServerError(""))
+		}
+
+		if !isSafeMethod(request.HTTPRequest.Method) {
+			check := func() responses.Response { return cm.check(request, token, isNew) }
+			if isCSRFDeferred(request) {
+				setCSRFCheck(request, check)
+			} else if response := check(); response != nil {
+				return response
+			}
+		}
+
+		setCSRFToken(request, token)
+
+		response := next(request)
+		if response == nil {
+			return response
+		}
+
+		if isNew && cm.options.Mode == CSRFDoubleSubmit {
+			response.Headers().Add("Set-Cookie", cm.cookie(token).String())
+		}
+
+		if tr, ok := response.(responses.TemplateResponse); ok {
+			tr.Funcs(template.FuncMap{
+				"csrfToken": func() string { return CSRFToken(request) },
+				"csrfField": func() string {
+					return `<input type="hidden" name="` + html.EscapeString(cm.options.FieldName) + `" value="` + CSRFToken(request) + `">`
+				},
+			})
+		}
+
+		return response
+	}
+}
+
+// check returns the failure response of unsafe request, nil when the request passes
+func (cm *CSRFMiddleware) check(r *request.Request, token []byte, isNew bool) responses.Response {
+	if isCSRFExempt(r) {
+		return nil
+	}
+
+	if reason := cm.checkOrigin(r); reason != "" {
+		return cm.options.FailureResponse(r, reason)
+	}
+
+	if isNew || !cm.validToken(r, token) {
+		return cm.options.FailureResponse(r, "missing or invalid token")
+	}
+
+	return nil
+}
+
+func setCSRFToken(r *request.Request, token []byte) {
+	request.SetValue(r, csrfTokenKey, string(token))
+}
+
+// setCSRFCheck chains the check after the checks of outer CSRF middlewares
+func setCSRFCheck(r *request.Request, check func() responses.Response) {
+	if outer, ok := request.GetValue(r, csrfCheckKey); ok && outer != nil {
+		inner := check
+		check = func() responses.Response {
+			if response := outer(); response != nil {
+				return response
+			}
+			return inner()
+		}
+	}
+
+	request.SetValue(r, csrfCheckKey, check)
+}
+
+func isCSRFExempt(r *request.Request) bool {
+	exempt, _ := request.GetValue(r, csrfExemptKey)
+	return exempt
+}
+
+func isCSRFDeferred(r *request.Request) bool {
+	deferred, _ := request.GetValue(r, csrfDeferKey)
+	return deferred
+}
+
+// loadToken returns the token of the request, new token when there is none
+func (cm *CSRFMiddleware) loadToken(r *request.Request) ([]byte, bool, error) {
+	if cm.options.Mode == CSRFSynchronizer {
+		session := r.Session()
+		if session == nil {
+			return nil, false, errors.New("CSRFSynchronizer mode requires the SessionMiddleware")
+		}
+
+		if value, ok := session.Get(cm.options.CookieName); ok {
+			if token, ok := value.(string); ok && len(token) == csrfTokenLength {
+				return []byte(token), false, nil
+			}
+		}
+
+		token := newCSRFToken()
+		session.Set(cm.options.CookieName, string(token))
+		return token, true, nil
+	}
+
+	if cookie, err := r.HTTPRequest.Cookie(cm.options.CookieName); err == nil {
+		if token, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil && len(token) == csrfTokenLength {
+			return token, false, nil
+		}
+	}
+
+	return newCSRFToken(), true, nil
+}
+
+// validToken compares the token sent in the header or form field with the stored token
+func (cm *CSRFMiddleware) validToken(r *request.Request, token []byte) bool {
+	sent := r.HTTPRequest.Header.Get(cm.options.HeaderName)
+	if sent == "" {
+		sent = r.HTTPRequest.PostFormValue(cm.options.FieldName)
+	}
+
+	sentToken, ok := unmaskCSRFToken(sent)
+	return ok && subtle.ConstantTimeCompare(sentToken, token) == 1
+}
+
+// checkOrigin returns the reason the request origin is not trusted, empty when trusted.
+// Requests without Origin and Referer are allowed, the token protects them.
+func (cm *CSRFMiddleware) checkOrigin(r *request.Request) string {
+	origin := r.HTTPRequest.Header.Get("Origin")
+	if origin == "" {
+		referer := r.HTTPRequest.Header.Get("Referer")
+		if referer == "" {
+			return ""
+		}
+
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return "invalid referer"
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	if origin == "null" {
+		return "untrusted origin"
+	}
+
+	for _, trusted := range cm.options.TrustedOrigins {
+		if strings.EqualFold(origin, trusted) {
+			return ""
+		}
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, r.HTTPRequest.Host) {
+		return "untrusted origin"
+	}
+
+	return ""
+}
+
+func (cm *CSRFMiddleware) cookie(token []byte) *http.Cookie {
+	return &http.Cookie{
+		Name:     cm.options.CookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(token),
+		Path:     cm.options.Path,
+		Domain:   cm.options.Domain,
+		Secure:   cm.options.Secure,
+		SameSite: cm.options.SameSite,
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || method == http.MethodTrace
+}
+
+func newCSRFToken() []byte {
+	token := make([]byte, csrfTokenLength)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// maskCSRFToken returns base64(pad + (pad xor token)) with random pad
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	pad := masked[:len(token)]
+	rand.Read(pad)
+
+	for i := range token {
+		masked[len(token)+i] = pad[i] ^ token[i]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCSRFToken accepts masked tokens and the raw token from the cookie
+func unmaskCSRFToken(masked string) ([]byte, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(masked)
+	if err == nil && len(data) == csrfTokenLength {
+		return data, true
+	}
+	if err != nil || len(data) != 2*csrfTokenLength {
+		return nil, false
+	}
+
+	token := make([]byte, csrfTokenLength)
+	for i := range token {
+		token[i] = data[i] ^ data[csrfTokenLength+i]
+	}
+
+	return token, true
+}
@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+func csrfRequest(method string, body url.Values, headers map[string]string) *request.Request {
+	httpRequest := httptest.NewRequest(method, "http://example.com/form", strings.NewReader(body.Encode()))
+	if body != nil {
+		httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for k, v := range headers {
+		httpRequest.Header.Set(k, v)
+	}
+	return request.NewRequest(httpRequest)
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	var token string
+	handler := NewCSRFMiddleware(CSRFOptions{TrustedOrigins: []string{"https://admin.example.com"}}).Apply(
+		func(request *request.Request) responses.Response {
+			token = CSRFToken(request)
+			return okHandler(request)
+		},
+	)
+
+	response := handler(csrfRequest(http.MethodGet, nil, nil))
+	cookie, _, _ := strings.Cut(response.Headers().Get("Set-Cookie"), ";")
+	if response.StatusCode() != http.StatusOK || !strings.HasPrefix(cookie, "csrf_token=") || token == "" {
+		t.Fatalf("expecting token cookie got %d '%s'", response.StatusCode(), cookie)
+	}
+
+	rawToken := strings.TrimPrefix(cookie, "csrf_token=")
+
+	cases := []struct {
+		name         string
+		body         url.Values
+		headers      map[string]string
+		expectedCode int
+	}{
+		{"no token", nil, map[string]string{"Cookie": cookie}, 403},
+		{"no cookie", nil, map[string]string{"X-CSRF-Token": token}, 403},
+		{"header token", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": token}, 200},
+		{"raw cookie token", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": rawToken}, 200},
+		{"form token", url.Values{"csrf_token": {token}}, map[string]string{"Cookie": cookie}, 200},
+		{"wrong token", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": maskCSRFToken(newCSRFToken())}, 403},
+		{"same origin", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": token, "Origin": "http://example.com"}, 200},
+		{"trusted origin", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": token, "Origin": "https://admin.example.com"}, 200},
+		{"cross origin", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": token, "Origin": "https://evil.com"}, 403},
+		{"null origin", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": token, "Origin": "null"}, 403},
+		{"cross referer", nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": token, "Referer": "https://evil.com/page"}, 403},
+	}
+
+	for _, c := range cases {
+		response := handler(csrfRequest(http.MethodPost, c.body, c.headers))
+		if response.StatusCode() != c.expectedCode {
+			t.Errorf("%s: expecting status-code %d got %d", c.name, c.expectedCode, response.StatusCode())
+		}
+	}
+
+	r := csrfRequest(http.MethodPost, nil, nil)
+	ExemptFromCSRF(r)
+	if response := handler(r); response.StatusCode() != http.StatusOK {
+		t.Errorf("expecting exempt request to pass got %d", response.StatusCode())
+	}
+}
+
+func TestCSRFSynchronizer(t *testing.T) {
+	sessions, _ := NewSessionMiddleware(SessionOptions{SigningKey: sessionKey})
+	handler := sessions.Apply(NewCSRFMiddleware(CSRFOptions{Mode: CSRFSynchronizer}).Apply(
+		func(request *request.Request) responses.Response {
+			return responses.NewHTMLResponse(CSRFToken(request), http.StatusOK)
+		},
+	))
+
+	response := handler(csrfRequest(http.MethodGet, nil, nil))
+	token := string(response.ToBytes())
+	cookie, _, _ := strings.Cut(response.Headers().Get("Set-Cookie"), ";")
+	if !strings.HasPrefix(cookie, "session=") {
+		t.Fatalf("expecting session cookie got '%s'", cookie)
+	}
+
+	if response := handler(csrfRequest(http.MethodPost, nil, map[string]string{"Cookie": cookie})); response.StatusCode() != 403 {
+		t.Errorf("expecting status-code 403 without token got %d", response.StatusCode())
+	}
+
+	if response := handler(csrfRequest(http.MethodPost, nil, map[string]string{"Cookie": cookie, "X-CSRF-Token": token})); response.StatusCode() != 200 {
+		t.Errorf("expecting status-code 200 with session token got %d", response.StatusCode())
+	}
+}
+
+func TestCSRFTemplateField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "form.html")
+	os.WriteFile(path, []byte(`<form method="post">{{ csrfField }}</form>`), 0644)
+
+	handler := NewCSRFMiddleware(CSRFOptions{}).Apply(func(request *request.Request) responses.Response {
+		return responses.NewTemplateResponse(path, nil, http.StatusOK)
+	})
+
+	body := string(handler(csrfRequest(http.MethodGet, nil, nil)).ToBytes())
+	if !strings.HasPrefix(body, `<form method="post"><input type="hidden" name="csrf_token" value="`) {
+		t.Errorf("expecting csrf field in the form got %s", body)
+	}
+
+	r := csrfRequest(http.MethodGet, nil, nil)
+	ExemptFromCSRF(r)
+	if body := string(handler(r).ToBytes()); body != `<form method="post"></form>` {
+		t.Errorf("expecting empty csrf field for exempt request got %s", body)
+	}
+}
@@ -0,0 +1,173 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+// ETagMiddleware handles conditional requests.
+//
+// For GET and HEAD requests the ETag of successful responses is computed from the response body
+// (unless the view already set it, template responses use only the view ETag), and requests with a matching If-None-Match or If-Modified-Since get 304 Not Modified.
+//
+// For PUT, PATCH and DELETE requests the If-Match, If-Unmodified-Since and If-None-Match preconditions are
+// evaluated against the current version of the resource (see CurrentVersion) before the view runs,
+// failing preconditions are answered with 412 Precondition Failed.
+type ETagMiddleware struct {
+	// Generate weak etags instead of strong ones
+	Weak bool
+
+	// Returns the current validators of the resource targeted by the request.
+	// Empty etag and zero time means the resource does not exist.
+	// When nil, preconditions of unsafe requests are not checked.
+	CurrentVersion func(request *request.Request) (etag string, lastModified time.Time)
+
+	// Reject unsafe requests without If-Match or If-Unmodified-Since with 428 Precondition Required
+	RequirePrecondition bool
+}
+
+func (em ETagMiddleware) Apply(next AppHandler) AppHandler {
+	return func(request *request.Request) responses.Response {
+		r := request.HTTPRequest
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			return em.conditionalGet(next, request)
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if em.CurrentVersion == nil {
+				return next(request)
+			}
+
+			if em.RequirePrecondition && r.Header.Get("If-Match") == "" && r.Header.Get("If-Unmodified-Since") == "" {
+				return responses.NewErrorResponse(http.StatusText(http.StatusPreconditionRequired), http.StatusPreconditionRequired)
+			}
+
+			etag, lastModified := em.CurrentVersion(request)
+			if !preconditionsPass(r, etag, lastModified) {
+				return responses.NewErrorResponse(http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+			}
+
+			return next(request)
+		default:
+			return next(request)
+		}
+	}
+}
+
+func (em ETagMiddleware) conditionalGet(next AppHandler, request *request.Request) responses.Response {
+	response := next(request)
+	if response == nil || response.StatusCode() != http.StatusOK {
+		return response
+	}
+
+	// Templates are rendered after the outer middlewares add their functions (csrfField, cspNonce, ...),
+	// they keep their type and get etag only from the view.
+	if _, isTemplate := response.(responses.TemplateResponse); !isTemplate && response.Headers().Get("ETag") == "" {
+		// Buffer the response so the body is rendered only once
+		body := response.ToBytes()
+		buffered := responses.NewResponse(body, response.StatusCode())
+		for k, values := range response.Headers() {
+			buffered.Headers()[k] = values
+		}
+
+		if em.Weak {
+			responses.SetETag(buffered, responses.NewWeakETag(body))
+		} else {
+			responses.SetETag(buffered, responses.NewETag(body))
+		}
+		response = buffered
+	}
+
+	if !preconditionsPass(request.HTTPRequest, response.Headers().Get("ETag"), parseHTTPTime(response.Headers().Get("Last-Modified"))) {
+		return responses.NewErrorResponse(http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	}
+
+	if isNotModified(request.HTTPRequest, response.Headers()) {
+		return responses.NewNotModifiedResponse(response)
+	}
+
+	return response
+}
+
+// preconditionsPass evaluates If-Match, If-Unmodified-Since and for unsafe methods If-None-Match (RFC 9110 section 13.2.2)
+func preconditionsPass(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, true) {
+			return false
+		}
+	} else if ifUnmodifiedSince := r.Header.Get("If-Unmodified-Since"); ifUnmodifiedSince != "" {
+		since, err := http.ParseTime(ifUnmodifiedSince)
+		if err == nil && !lastModified.IsZero() && lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	isSafe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && !isSafe {
+		if etagListMatches(ifNoneMatch, etag, false) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isNotModified reports whether the conditional GET / HEAD request can be answered with 304
+func isNotModified(r *http.Request, headers http.Header) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagListMatches(ifNoneMatch, headers.Get("ETag"), false)
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+
+		lastModified := parseHTTPTime(headers.Get("Last-Modified"))
+		if lastModified.IsZero() {
+			return false
+		}
+
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// etagListMatches checks if the etag is in the If-Match / If-None-Match list.
+// strong comparison requires both etags to be strong (RFC 9110 section 8.8.3.2).
+func etagListMatches(list string, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	for _, candidate := range parseHeaderList(list) {
+		if strong {
+			if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+				return true
+			}
+		} else if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseHTTPTime parse http date, returns zero time for invalid or empty values
+func parseHTTPTime(value string) time.Time {
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
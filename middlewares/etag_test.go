@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+func TestETagConditionalGet(t *testing.T) {
+	handler := ETagMiddleware{}.Apply(okHandler)
+
+	response := handler(cacheRequest(http.MethodGet, "/", nil))
+	etag := response.Headers().Get("ETag")
+	if etag != responses.NewETag([]byte("ok")) {
+		t.Fatalf("expecting strong etag of the body got '%s'", etag)
+	}
+
+	response = handler(cacheRequest(http.MethodGet, "/", map[string]string{"If-None-Match": `"other", ` + etag}))
+	if response.StatusCode() != http.StatusNotModified || len(response.ToBytes()) != 0 {
+		t.Errorf("expecting empty 304 response got %d", response.StatusCode())
+	}
+	if response.Headers().Get("ETag") != etag {
+		t.Errorf("expecting 304 response to include the etag")
+	}
+
+	response = handler(cacheRequest(http.MethodGet, "/", map[string]string{"If-None-Match": `"other"`}))
+	if response.StatusCode() != http.StatusOK {
+		t.Errorf("expecting status-code 200 got %d", response.StatusCode())
+	}
+
+	weak := ETagMiddleware{Weak: true}.Apply(okHandler)(cacheRequest(http.MethodGet, "/", nil))
+	if weak.Headers().Get("ETag") != responses.NewWeakETag([]byte("ok")) {
+		t.Errorf("expecting weak etag got '%s'", weak.Headers().Get("ETag"))
+	}
+}
+
+func TestETagTemplateResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "form.html")
+	os.WriteFile(path, []byte(`<form method="post">{{ csrfField }}</form>`), 0644)
+
+	// The CSRF middleware adds csrfField after the etag middleware returns the template
+	handler := NewCSRFMiddleware(CSRFOptions{}).Apply(ETagMiddleware{}.Apply(func(request *request.Request) responses.Response {
+		response := responses.NewTemplateResponse(path, nil, http.StatusOK)
+		responses.SetETag(response, `"v1"`)
+		return response
+	}))
+
+	response := handler(cacheRequest(http.MethodGet, "/", nil))
+	if body := string(response.ToBytes()); !strings.Contains(body, `name="csrf_token"`) {
+		t.Errorf("expecting template with csrf field got %s", body)
+	}
+
+	response = handler(cacheRequest(http.MethodGet, "/", map[string]string{"If-None-Match": `"v1"`}))
+	if response.StatusCode() != http.StatusNotModified {
+		t.Errorf("expecting status-code 304 for the view etag got %d", response.StatusCode())
+	}
+}
+
+func TestETagPreconditions(t *testing.T) {
+	lastModified := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	em := ETagMiddleware{
+		CurrentVersion: func(request *request.Request) (string, time.Time) {
+			return `"v2"`, lastModified
+		},
+	}
+	handler := em.Apply(okHandler)
+
+	cases := []struct {
+		headers      map[string]string
+		expectedCode int
+	}{
+		{map[string]string{"If-Match": `"v2"`}, http.StatusOK},
+		{map[string]string{"If-Match": `"v1"`}, http.StatusPreconditionFailed},
+		{map[string]string{"If-Match": `W/"v2"`}, http.StatusPreconditionFailed},
+		{map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed},
+		{map[string]string{"If-Unmodified-Since": lastModified.Add(time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+		{map[string]string{"If-Unmodified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusPreconditionFailed},
+		{nil, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		response := handler(cacheRequest(http.MethodPut, "/", c.headers))
+		if response.StatusCode() != c.expectedCode {
+			t.Errorf("%v: expecting status-code %d got %d", c.headers, c.expectedCode, response.StatusCode())
+		}
+	}
+
+	em.RequirePrecondition = true
+	response := em.Apply(okHandler)(cacheRequest(http.MethodDelete, "/", nil))
+	if response.StatusCode() != http.StatusPreconditionRequired {
+		t.Errorf("expecting status-code 428 got %d", response.StatusCode())
+	}
+}
@@ -1,23 +1,70 @@
 package middlewares
 
 import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hvuhsg/goapi/request"
 	"github.com/hvuhsg/goapi/responses"
 )
 
+// IPFilterMiddleware restricts access to the views by the client IP address.
+//
+// Entries in AllowedIPs and DeniedIPs can be single IPv4/IPv6 addresses or CIDR ranges ("10.0.0.0/8", "2001:db8::/32").
+// Denied entries take precedence over allowed ones. When AllowedIPs is empty and DeniedIPs is not, only the deny list
+// is enforced (deny-only filter), with both lists empty all the requests are denied.
+//
+// The struct can be used as a literal for static rules, malformed entries are logged and all the requests are denied.
+// Use NewIPFilterMiddleware to validate the entries and replace the rules at runtime (SetRules, WatchFile),
+// its rules are kept internally, read them with Rules.
 type IPFilterMiddleware struct {
+	// Static rules of literals, not used by NewIPFilterMiddleware
 	AllowedIPs []string
+	DeniedIPs  []string
+
+	// Response returned to rejected clients, defaults to 403 "Access denied".
+	DeniedResponse func(request *request.Request) responses.Response
+
+	rules *ipRules
+}
+
+// Create ip filter middleware with rules that can be reloaded at runtime
+func NewIPFilterMiddleware(allowedIPs []string, deniedIPs []string) (*IPFilterMiddleware, error) {
+	ipm := &IPFilterMiddleware{rules: &ipRules{}}
+	if err := ipm.SetRules(allowedIPs, deniedIPs); err != nil {
+		return nil, err
+	}
+
+	return ipm, nil
 }
 
 func (ipm IPFilterMiddleware) Apply(next AppHandler) AppHandler {
+	rules := ipm.rules
+	valid := true
+	if rules == nil {
+		rules = &ipRules{}
+		if err := rules.set(ipm.AllowedIPs, ipm.DeniedIPs); err != nil {
+			log.Printf("ERROR: invalid ip filter rules, all requests are denied: %s\n", err)
+			valid = false
+		}
+	}
+
 	return func(request *request.Request) responses.Response {
-		clientIP := strings.Split(request.HTTPRequest.RemoteAddr, ":")[0]
+		clientIP := net.ParseIP(clientHost(request.HTTPRequest.RemoteAddr))
 
 		// Check if the client IP is allowed
-		if !ipm.isAllowedIP(clientIP) {
+		if !valid || clientIP == nil || !rules.isAllowed(clientIP) {
+			if ipm.DeniedResponse != nil {
+				return ipm.DeniedResponse(request)
+			}
+
 			return responses.NewHTMLResponse("Access denied", http.StatusForbidden)
 		}
 
@@ -25,11 +72,207 @@ func (ipm IPFilterMiddleware) Apply(next AppHandler) AppHandler {
 	}
 }
 
-func (ipm IPFilterMiddleware) isAllowedIP(ip string) bool {
-	for _, allowedIP := range ipm.AllowedIPs {
-		if allowedIP == ip {
+// SetRules replace the allow and deny lists, in-flight requests are not affected.
+// Must be called on middleware created with NewIPFilterMiddleware.
+func (ipm *IPFilterMiddleware) SetRules(allowedIPs []string, deniedIPs []string) error {
+	if ipm.rules == nil {
+		return fmt.Errorf("ip filter rules can only be reloaded when created with NewIPFilterMiddleware")
+	}
+
+	return ipm.rules.set(allowedIPs, deniedIPs)
+}
+
+// Rules returns the current allow and deny lists.
+func (ipm *IPFilterMiddleware) Rules() (allowedIPs []string, deniedIPs []string) {
+	if ipm.rules == nil {
+		return ipm.AllowedIPs, ipm.DeniedIPs
+	}
+
+	ipm.rules.lock.RLock()
+	defer ipm.rules.lock.RUnlock()
+	return ipm.rules.allowedIPs, ipm.rules.deniedIPs
+}
+
+// LoadFile reads the rules from file and replace the current rules.
+//
+// The file contains a rule per line in the format "<allow|deny> <ip or cidr>",
+// empty lines and lines starting with '#' are ignored. A file without rules denies all the requests.
+func (ipm *IPFilterMiddleware) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	allowed := make([]string, 0)
+	denied := make([]string, 0)
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expecting '<allow|deny> <ip or cidr>'", path, lineNumber)
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			allowed = append(allowed, fields[1])
+		case "deny":
+			denied = append(denied, fields[1])
+		default:
+			return fmt.Errorf("%s:%d: unknown action '%s'", path, lineNumber, fields[0])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return ipm.SetRules(allowed, denied)
+}
+
+// WatchFile loads the rules from file and reloads them every time the file is modified.
+// The file is checked every interval, invalid files are logged and the previous rules are kept.
+// Call the returned function to stop watching.
+func (ipm *IPFilterMiddleware) WatchFile(path string, interval time.Duration) (func(), error) {
+	if err := ipm.LoadFile(path); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	lastModified := info.ModTime()
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil || info.ModTime().Equal(lastModified) {
+					continue
+				}
+				lastModified = info.ModTime()
+
+				if err := ipm.LoadFile(path); err != nil {
+					log.Printf("ERROR: can't reload ip filter rules: %s\n", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+type ipRules struct {
+	lock    sync.RWMutex
+	allowed []*net.IPNet
+	denied  []*net.IPNet
+
+	allowedIPs []string // The entries of the rules, returned by Rules
+	deniedIPs  []string
+}
+
+func (rules *ipRules) set(allowedIPs []string, deniedIPs []string) error {
+	allowed, err := parseIPNets(allowedIPs)
+	if err != nil {
+		return err
+	}
+
+	denied, err := parseIPNets(deniedIPs)
+	if err != nil {
+		return err
+	}
+
+	rules.lock.Lock()
+	defer rules.lock.Unlock()
+
+	rules.allowed = allowed
+	rules.denied = denied
+	rules.allowedIPs = allowedIPs
+	rules.deniedIPs = deniedIPs
+
+	return nil
+}
+
+func (rules *ipRules) isAllowed(ip net.IP) bool {
+	rules.lock.RLock()
+	defer rules.lock.RUnlock()
+
+	if containsIP(rules.denied, ip) {
+		return false
+	}
+
+	// Deny-only filter, empty rules (e.g loaded from unset config) deny everyone
+	if len(rules.allowed) == 0 {
+		return len(rules.denied) > 0
+	}
+
+	return containsIP(rules.allowed, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
 			return true
 		}
 	}
 	return false
 }
+
+// parseIPNets parse single ips and cidr ranges, single ips are converted to full mask networks
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		if strings.Contains(entry, "/") {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr '%s': %w", entry, err)
+			}
+			nets = append(nets, ipNet)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip '%s'", entry)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			bits = 8 * net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return nets, nil
+}
+
+// clientHost strips the port from remote address, supports IPv6 addresses
+func clientHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+func okHandler(request *request.Request) responses.Response {
+	return responses.NewHTMLResponse("ok", http.StatusOK)
+}
+
+func requestFrom(remoteAddr string) *request.Request {
+	httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+	httpRequest.RemoteAddr = remoteAddr
+	return request.NewRequest(httpRequest)
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	handler := IPFilterMiddleware{
+		AllowedIPs: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.1"},
+		DeniedIPs:  []string{"10.0.0.5"},
+	}.Apply(okHandler)
+
+	cases := map[string]int{
+		"10.1.2.3:1234":         http.StatusOK,
+		"192.168.1.1:80":        http.StatusOK,
+		"[2001:db8::1]:443":     http.StatusOK,
+		"10.0.0.5:1234":         http.StatusForbidden,
+		"192.168.1.2:80":        http.StatusForbidden,
+		"[2001:db9::1]:443":     http.StatusForbidden,
+		"not-an-ip-address:443": http.StatusForbidden,
+	}
+
+	for remoteAddr, expectedCode := range cases {
+		response := handler(requestFrom(remoteAddr))
+		if response.StatusCode() != expectedCode {
+			t.Errorf("%s: expecting status-code %d got %d", remoteAddr, expectedCode, response.StatusCode())
+		}
+	}
+}
+
+func TestIPFilterDenyOnly(t *testing.T) {
+	handler := IPFilterMiddleware{
+		DeniedIPs: []string{"1.2.3.0/24"},
+		DeniedResponse: func(request *request.Request) responses.Response {
+			return responses.NewJSONResponse(responses.Json{"error": "blocked"}, http.StatusUnauthorized)
+		},
+	}.Apply(okHandler)
+
+	if code := handler(requestFrom("1.2.3.4:80")).StatusCode(); code != http.StatusUnauthorized {
+		t.Errorf("expecting custom denied response got status-code %d", code)
+	}
+
+	if code := handler(requestFrom("4.3.2.1:80")).StatusCode(); code != http.StatusOK {
+		t.Errorf("expecting status-code 200 got %d", code)
+	}
+}
+
+func TestIPFilterEmptyRules(t *testing.T) {
+	handler := IPFilterMiddleware{AllowedIPs: nil}.Apply(okHandler)
+	if code := handler(requestFrom("10.0.0.1:80")).StatusCode(); code != http.StatusForbidden {
+		t.Errorf("expecting empty rules to deny all requests got %d", code)
+	}
+
+	ipm, _ := NewIPFilterMiddleware(nil, []string{})
+	if code := ipm.Apply(okHandler)(requestFrom("10.0.0.1:80")).StatusCode(); code != http.StatusForbidden {
+		t.Errorf("expecting empty rules to deny all requests got %d", code)
+	}
+}
+
+func TestIPFilterInvalidRules(t *testing.T) {
+	if _, err := NewIPFilterMiddleware([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Errorf("expecting error on invalid rule")
+	}
+
+	handler := IPFilterMiddleware{AllowedIPs: []string{"10.0.0.1", "not-an-ip"}}.Apply(okHandler)
+	if code := handler(requestFrom("10.0.0.1:80")).StatusCode(); code != http.StatusForbidden {
+		t.Errorf("expecting invalid static rules to deny all requests got %d", code)
+	}
+}
+
+func TestIPFilterReload(t *testing.T) {
+	ipm, err := NewIPFilterMiddleware([]string{"127.0.0.1"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	handler := ipm.Apply(okHandler)
+
+	if code := handler(requestFrom("127.0.0.1:80")).StatusCode(); code != http.StatusOK {
+		t.Errorf("expecting status-code 200 got %d", code)
+	}
+
+	rulesPath := filepath.Join(t.TempDir(), "rules")
+	os.WriteFile(rulesPath, []byte("# local only\nallow 127.0.0.0/8\ndeny 127.0.0.1\n"), 0644)
+
+	stop, err := ipm.WatchFile(rulesPath, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer stop()
+
+	if code := handler(requestFrom("127.0.0.1:80")).StatusCode(); code != http.StatusForbidden {
+		t.Errorf("expecting status-code 403 after loading rules got %d", code)
+	}
+
+	// The watcher reloads the modified file
+	os.WriteFile(rulesPath, []byte("allow 127.0.0.1\n"), 0644)
+	modified := time.Now().Add(time.Second)
+	os.Chtimes(rulesPath, modified, modified)
+
+	deadline := time.Now().Add(time.Second)
+	for handler(requestFrom("127.0.0.1:80")).StatusCode() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatalf("expecting watcher to apply the new rules")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if allowed, denied := ipm.Rules(); len(allowed) != 1 || allowed[0] != "127.0.0.1" || len(denied) != 0 {
+		t.Errorf("expecting the loaded rules got %v %v", allowed, denied)
+	}
+
+	if err := ipm.SetRules([]string{"not-an-ip"}, nil); err == nil {
+		t.Errorf("expecting error on invalid rule")
+	}
+	if allowed, _ := ipm.Rules(); len(allowed) != 1 || allowed[0] != "127.0.0.1" {
+		t.Errorf("expecting invalid rules to keep the current rules got %v", allowed)
+	}
+
+	if err := (&IPFilterMiddleware{}).SetRules(nil, nil); err == nil {
+		t.Errorf("expecting error when reloading rules of static middleware")
+	}
+}
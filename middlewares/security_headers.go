@@ -0,0 +1,175 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+// SecurityHeadersOptions configures the SecurityHeadersMiddleware, empty fields are not sent.
+type SecurityHeadersOptions struct {
+	HSTSMaxAge            time.Duration // Strict-Transport-Security max-age, browsers ignore it over http
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// Content-Security-Policy, "{nonce}" is replaced with per-request nonce
+	// (e.g "script-src 'self' 'nonce-{nonce}'"), views get the nonce with CSPNonce.
+	ContentSecurityPolicy string
+	CSPReportOnly         bool // Send Content-Security-Policy-Report-Only instead
+
+	FrameOptions              string // X-Frame-Options, DENY or SAMEORIGIN
+	NoSniff                   bool   // X-Content-Type-Options: nosniff
+	ReferrerPolicy            string // Referrer-Policy
+	PermissionsPolicy         string // Permissions-Policy (e.g "camera=(), microphone=()")
+	CrossOriginOpenerPolicy   string // Cross-Origin-Opener-Policy
+	CrossOriginEmbedderPolicy string // Cross-Origin-Embedder-Policy
+	CrossOriginResourcePolicy string // Cross-Origin-Resource-Policy
+}
+
+// DefaultSecurityHeaders is a preset for apps that serve HTML, scripts must carry the CSP nonce.
+func DefaultSecurityHeaders() SecurityHeadersOptions {
+	return SecurityHeadersOptions{
+		HSTSMaxAge:              365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:   true,
+		ContentSecurityPolicy:   "default-src 'self'; script-src 'self' 'nonce-{nonce}'; object-src 'none'; base-uri 'self'; frame-ancestors 'self'",
+		FrameOptions:            "SAMEORIGIN",
+		NoSniff:                 true,
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		CrossOriginOpenerPolicy: "same-origin",
+	}
+}
+
+// StrictSecurityHeaders is a preset that isolates the app from other origins.
+func StrictSecurityHeaders() SecurityHeadersOptions {
+	return SecurityHeadersOptions{
+		HSTSMaxAge:                2 * 365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:     true,
+		HSTSPreload:               true,
+		ContentSecurityPolicy:     "default-src 'self'; script-src 'nonce-{nonce}' 'strict-dynamic'; style-src 'self' 'nonce-{nonce}'; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'",
+		FrameOptions:              "DENY",
+		NoSniff:                   true,
+		ReferrerPolicy:            "no-referrer",
+		PermissionsPolicy:         "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+		CrossOriginResourcePolicy: "same-origin",
+	}
+}
+
+// APISecurityHeaders is a preset for JSON APIs that never render HTML.
+func APISecurityHeaders() SecurityHeadersOptions {
+	return SecurityHeadersOptions{
+		HSTSMaxAge:                365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:     true,
+		ContentSecurityPolicy:     "default-src 'none'; frame-ancestors 'none'",
+		FrameOptions:              "DENY",
+		NoSniff:                   true,
+		ReferrerPolicy:            "no-referrer",
+		CrossOriginResourcePolicy: "same-origin",
+	}
+}
+
+// SecurityHeadersMiddleware adds security headers to the responses, headers set by the view are kept.
+//
+// A SecurityHeadersMiddleware applied on a view overrides the one applied on the app.
+// Template responses get the cspNonce template function:
+//
+//	<script nonce="{{ cspNonce }}">...</script>
+type SecurityHeadersMiddleware struct {
+	options SecurityHeadersOptions
+}
+
+var cspNonceKey = request.NewKey[string]("csp-nonce")
+
+// Marks requests that already got headers from an outer SecurityHeadersMiddleware
+type securityHeadersOverrideKey struct{}
+
+func NewSecurityHeadersMiddleware(options SecurityHeadersOptions) *SecurityHeadersMiddleware {
+	return &SecurityHeadersMiddleware{options: options}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the request
+func CSPNonce(r *request.Request) string {
+	nonce, _ := request.GetValue(r, cspNonceKey)
+	return nonce
+}
+
+func (sh *SecurityHeadersMiddleware) Apply(next AppHandler) AppHandler {
+	return func(request *request.Request) responses.Response {
+		// Outer (view level) middleware overrides this one
+		if request.Context().Value(securityHeadersOverrideKey{}) != nil {
+			return next(request)
+		}
+		request.SetContext(context.WithValue(request.Context(), securityHeadersOverrideKey{}, true))
+
+		nonce := ""
+		if strings.Contains(sh.options.ContentSecurityPolicy, "{nonce}") {
+			nonce = newCSPNonce()
+			setCSPNonce(request, nonce)
+		}
+
+		response := next(request)
+		if response == nil {
+			return response
+		}
+
+		headers := response.Headers()
+		setDefault := func(key string, value string) {
+			if value != "" && headers.Get(key) == "" {
+				headers.Set(key, value)
+			}
+		}
+
+		if sh.options.HSTSMaxAge > 0 {
+			hsts := "max-age=" + strconv.Itoa(int(sh.options.HSTSMaxAge.Seconds()))
+			if sh.options.HSTSIncludeSubdomains {
+				hsts += "; includeSubDomains"
+			}
+			if sh.options.HSTSPreload {
+				hsts += "; preload"
+			}
+			setDefault("Strict-Transport-Security", hsts)
+		}
+
+		cspHeader := "Content-Security-Policy"
+		if sh.options.CSPReportOnly {
+			cspHeader = "Content-Security-Policy-Report-Only"
+		}
+		setDefault(cspHeader, strings.ReplaceAll(sh.options.ContentSecurityPolicy, "{nonce}", nonce))
+
+		setDefault("X-Frame-Options", sh.options.FrameOptions)
+		if sh.options.NoSniff {
+			setDefault("X-Content-Type-Options", "nosniff")
+		}
+		setDefault("Referrer-Policy", sh.options.ReferrerPolicy)
+		setDefault("Permissions-Policy", sh.options.PermissionsPolicy)
+		setDefault("Cross-Origin-Opener-Policy", sh.options.CrossOriginOpenerPolicy)
+		setDefault("Cross-Origin-Embedder-Policy", sh.options.CrossOriginEmbedderPolicy)
+		setDefault("Cross-Origin-Resource-Policy", sh.options.CrossOriginResourcePolicy)
+
+		if tr, ok := response.(responses.TemplateResponse); ok {
+			tr.Funcs(template.FuncMap{"cspNonce": func() string { return nonce }})
+		}
+
+		return response
+	}
+}
+
+func setCSPNonce(r *request.Request, nonce string) {
+	request.SetValue(r, cspNonceKey, nonce)
+}
+
+func newCSPNonce() string {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(nonce)
+}
@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(path, []byte(`<script nonce="{{ cspNonce }}"></script>`), 0644)
+
+	var nonce string
+	handler := NewSecurityHeadersMiddleware(DefaultSecurityHeaders()).Apply(func(request *request.Request) responses.Response {
+		nonce = CSPNonce(request)
+		response := responses.NewTemplateResponse(path, nil, http.StatusOK)
+		response.Headers().Set("X-Frame-Options", "DENY")
+		return response
+	})
+
+	response := handler(request.NewRequest(httptest.NewRequest(http.MethodGet, "/", nil)))
+	headers := response.Headers()
+
+	expected := map[string]string{
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		"X-Frame-Options":           "DENY",
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+	}
+	for header, value := range expected {
+		if headers.Get(header) != value {
+			t.Errorf("expecting %s '%s' got '%s'", header, value, headers.Get(header))
+		}
+	}
+
+	if nonce == "" || !strings.Contains(headers.Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("expecting nonce %s in the csp got '%s'", nonce, headers.Get("Content-Security-Policy"))
+	}
+
+	if body := string(response.ToBytes()); body != `<script nonce="`+nonce+`"></script>` {
+		t.Errorf("expecting nonce in the template got %s", body)
+	}
+}
+
+func TestSecurityHeadersViewOverride(t *testing.T) {
+	app := NewSecurityHeadersMiddleware(StrictSecurityHeaders())
+	view := NewSecurityHeadersMiddleware(SecurityHeadersOptions{FrameOptions: "SAMEORIGIN"})
+
+	// View middlewares wrap the app middlewares
+	handler := view.Apply(app.Apply(okHandler))
+	headers := handler(request.NewRequest(httptest.NewRequest(http.MethodGet, "/", nil))).Headers()
+
+	if headers.Get("X-Frame-Options") != "SAMEORIGIN" {
+		t.Errorf("expecting view X-Frame-Options got '%s'", headers.Get("X-Frame-Options"))
+	}
+
+	if headers.Get("Strict-Transport-Security") != "" || headers.Get("Content-Security-Policy") != "" {
+		t.Errorf("expecting app headers to be overridden got %v", headers)
+	}
+}
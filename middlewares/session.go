@@ -0,0 +1,388 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+// Browsers ignore cookies larger than 4KB
+const maxCookieSize = 4096
+
+// SessionOptions configures the SessionMiddleware.
+type SessionOptions struct {
+	// Server-side session store, the cookie holds only the signed session id.
+	// When nil the session values are kept in the cookie itself (cookie sessions).
+	Store SessionStore
+
+	SigningKey    []byte // HMAC-SHA256 key that signs the cookie, required (at least 32 bytes)
+	EncryptionKey []byte // AES key (16, 24 or 32 bytes) that encrypts the cookie, optional
+
+	CookieName string        // default to "session"
+	Path       string        // default to "/"
+	Domain     string        // Cookie domain, default to the request host
+	Secure     bool          // Send the cookie only over https
+	SameSite   http.SameSite // default to http.SameSiteLaxMode
+
+	IdleTimeout     time.Duration // Session expires after being unused for this long, default to 30 minutes
+	AbsoluteTimeout time.Duration // Session expires this long after creation regardless of use, default to 24 hours
+}
+
+// SessionMiddleware loads the session of the request from the session cookie and saves it after the view,
+// the view accesses it with request.Session().
+type SessionMiddleware struct {
+	options SessionOptions
+	aead    cipher.AEAD
+}
+
+func NewSessionMiddleware(options SessionOptions) (*SessionMiddleware, error) {
+	if len(options.SigningKey) < 32 {
+		return nil, errors.New("session signing key must be at least 32 bytes")
+	}
+
+	sm := &SessionMiddleware{options: options}
+
+	if options.EncryptionKey != nil {
+		block, err := aes.NewCipher(options.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+
+		sm.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if sm.options.CookieName == "" {
+		sm.options.CookieName = "session"
+	}
+	if sm.options.Path == "" {
+		sm.options.Path = "/"
+	}
+	if sm.options.SameSite == 0 {
+		sm.options.SameSite = http.SameSiteLaxMode
+	}
+	if sm.options.IdleTimeout == 0 {
+		sm.options.IdleTimeout = 30 * time.Minute
+	}
+	if sm.options.AbsoluteTimeout == 0 {
+		sm.options.AbsoluteTimeout = 24 * time.Hour
+	}
+
+	return sm, nil
+}
+
+func (sm *SessionMiddleware) Apply(next AppHandler) AppHandler {
+	return func(request *request.Request) responses.Response {
+		sess, hadCookie := sm.load(request)
+		request.SetSession(sess)
+
+		response := next(request)
+		if response == nil {
+			return response
+		}
+
+		if err := sm.save(sess, hadCookie, response.Headers()); err != nil {
+			log.Printf("session: failed to save session: %s\n", err)
+		}
+
+		return response
+	}
+}
+
+// load returns the session of the request, new session when there is no valid session cookie
+func (sm *SessionMiddleware) load(request *request.Request) (*session, bool) {
+	if request.HTTPRequest == nil {
+		return newSession(), false
+	}
+
+	cookie, err := request.HTTPRequest.Cookie(sm.options.CookieName)
+	if err != nil {
+		return newSession(), false
+	}
+
+	payload, ok := sm.decodeCookie(cookie.Value)
+	if !ok {
+		return newSession(), true
+	}
+
+	var id string
+	var record *SessionRecord
+	if sm.options.Store != nil {
+		id = string(payload)
+		record, err = sm.options.Store.Load(id)
+		if err != nil {
+			log.Printf("session: failed to load session: %s\n", err)
+		}
+	} else {
+		var cs cookieSession
+		if gob.NewDecoder(bytes.NewReader(payload)).Decode(&cs) == nil {
+			id = cs.ID
+			record, _ = decodeSessionRecord(cs.Record)
+		}
+	}
+
+	if record == nil {
+		return newSession(), true
+	}
+
+	now := time.Now()
+	if now.Sub(record.LastAccess) > sm.options.IdleTimeout || now.Sub(record.CreatedAt) > sm.options.AbsoluteTimeout {
+		if sm.options.Store != nil {
+			sm.options.Store.Delete(id)
+		}
+		return newSession(), true
+	}
+
+	return &session{id: id, record: record}, true
+}
+
+// save stores the session and sets the cookie on the response
+func (sm *SessionMiddleware) save(sess *session, hadCookie bool, headers http.Header) error {
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+
+	if sm.options.Store != nil {
+		for _, id := range sess.oldIDs {
+			if err := sm.options.Store.Delete(id); err != nil {
+				return err
+			}
+		}
+	}
+
+	if sess.destroyed {
+		if hadCookie {
+			setSessionCookie(headers, sm.cookie("", -1))
+		}
+		return nil
+	}
+
+	// Don't create sessions for requests that didn't use them
+	if sess.isNew && !sess.modified {
+		return nil
+	}
+
+	now := time.Now()
+	sess.record.LastAccess = now
+	ttl := sm.options.AbsoluteTimeout - now.Sub(sess.record.CreatedAt)
+	if ttl > sm.options.IdleTimeout {
+		ttl = sm.options.IdleTimeout
+	}
+
+	var payload []byte
+	if sm.options.Store != nil {
+		if err := sm.options.Store.Save(sess.id, sess.record, ttl); err != nil {
+			return err
+		}
+		payload = []byte(sess.id)
+	} else {
+		record, err := encodeSessionRecord(sess.record)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(cookieSession{ID: sess.id, Record: record}); err != nil {
+			return err
+		}
+		payload = buf.Bytes()
+	}
+
+	value, err := sm.encodeCookie(payload)
+	if err != nil {
+		return err
+	}
+
+	cookie := sm.cookie(value, int(ttl.Seconds()))
+	if len(cookie.String()) > maxCookieSize {
+		return errors.New("session cookie is larger than 4KB, use server-side session store")
+	}
+
+	setSessionCookie(headers, cookie)
+	return nil
+}
+
+// setSessionCookie sets the cookie and keeps the response out of shared caches,
+// a cached response would hand the session to other users.
+func setSessionCookie(headers http.Header, cookie *http.Cookie) {
+	headers.Add("Set-Cookie", cookie.String())
+	headers.Set("Cache-Control", "private, no-store")
+
+	for _, value := range headers.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Cookie") {
+				return
+			}
+		}
+	}
+	headers.Add("Vary", "Cookie")
+}
+
+func (sm *SessionMiddleware) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sm.options.CookieName,
+		Value:    value,
+		Path:     sm.options.Path,
+		Domain:   sm.options.Domain,
+		MaxAge:   maxAge,
+		Secure:   sm.options.Secure,
+		HttpOnly: true,
+		SameSite: sm.options.SameSite,
+	}
+}
+
+// encodeCookie encrypts (when configured) and signs the payload, the signature covers the cookie name
+// so values can't be moved between cookies.
+func (sm *SessionMiddleware) encodeCookie(payload []byte) (string, error) {
+	if sm.aead != nil {
+		nonce := make([]byte, sm.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = sm.aead.Seal(nonce, nonce, payload, []byte(sm.options.CookieName))
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	return value + "." + base64.RawURLEncoding.EncodeToString(sm.sign(value)), nil
+}
+
+func (sm *SessionMiddleware) decodeCookie(cookie string) ([]byte, bool) {
+	value, signature, found := strings.Cut(cookie, ".")
+	if !found {
+		return nil, false
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sm.sign(value)) {
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+
+	if sm.aead != nil {
+		if len(payload) < sm.aead.NonceSize() {
+			return nil, false
+		}
+
+		nonce, ciphertext := payload[:sm.aead.NonceSize()], payload[sm.aead.NonceSize():]
+		payload, err = sm.aead.Open(nil, nonce, ciphertext, []byte(sm.options.CookieName))
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	return payload, true
+}
+
+func (sm *SessionMiddleware) sign(value string) []byte {
+	mac := hmac.New(sha256.New, sm.options.SigningKey)
+	mac.Write([]byte(sm.options.CookieName + "|" + value))
+	return mac.Sum(nil)
+}
+
+// cookieSession is the content of the cookie of cookie sessions
+type cookieSession struct {
+	ID     string
+	Record []byte
+}
+
+// session implements request.Session
+type session struct {
+	lock      sync.Mutex
+	id        string
+	record    *SessionRecord
+	oldIDs    []string // ids replaced by Regenerate, deleted from the store on save
+	isNew     bool
+	modified  bool
+	destroyed bool
+}
+
+func newSession() *session {
+	now := time.Now()
+	return &session{
+		id:     newSessionID(),
+		record: &SessionRecord{Values: make(map[string]any), CreatedAt: now, LastAccess: now},
+		isNew:  true,
+	}
+}
+
+func newSessionID() string {
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func (s *session) ID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.id
+}
+
+func (s *session) Get(key string) (any, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	value, ok := s.record.Values[key]
+	return value, ok
+}
+
+func (s *session) Set(key string, value any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.record.Values[key] = value
+	s.modified = true
+}
+
+func (s *session) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.record.Values, key)
+	s.modified = true
+}
+
+func (s *session) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.record.Values = make(map[string]any)
+	s.modified = true
+}
+
+func (s *session) Regenerate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.isNew {
+		s.oldIDs = append(s.oldIDs, s.id)
+	}
+	// Keep CreatedAt, regenerating doesn't extend the absolute timeout
+	s.id = newSessionID()
+	s.modified = true
+}
+
+func (s *session) Destroy() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.isNew {
+		s.oldIDs = append(s.oldIDs, s.id)
+	}
+	s.record.Values = make(map[string]any)
+	s.destroyed = true
+}
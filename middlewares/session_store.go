@@ -0,0 +1,227 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// SessionRecord is the stored state of a session.
+//
+// Values are encoded with encoding/gob, custom types stored in sessions must be registered with gob.Register.
+type SessionRecord struct {
+	Values     map[string]any
+	CreatedAt  time.Time
+	LastAccess time.Time
+}
+
+// SessionStore keeps the sessions on the server side, the cookie holds only the signed session id.
+type SessionStore interface {
+	// Load returns the session record, nil without error when the session doesn't exist or expired.
+	Load(id string) (*SessionRecord, error)
+	Save(id string, record *SessionRecord, ttl time.Duration) error
+	Delete(id string) error
+}
+
+func encodeSessionRecord(record *SessionRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSessionRecord(data []byte) (*SessionRecord, error) {
+	record := new(SessionRecord)
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(record); err != nil {
+		return nil, err
+	}
+
+	if record.Values == nil {
+		record.Values = make(map[string]any)
+	}
+	return record, nil
+}
+
+type memorySessionStore struct {
+	cache *cache.Cache
+}
+
+// Create in-memory session store, expired sessions are removed every cleanupInterval.
+// The records are stored encoded so requests never share the values.
+func NewMemorySessionStore(cleanupInterval time.Duration) SessionStore {
+	return &memorySessionStore{cache: cache.New(cache.NoExpiration, cleanupInterval)}
+}
+
+func (ms *memorySessionStore) Load(id string) (*SessionRecord, error) {
+	data, found := ms.cache.Get(id)
+	if !found {
+		return nil, nil
+	}
+
+	return decodeSessionRecord(data.([]byte))
+}
+
+func (ms *memorySessionStore) Save(id string, record *SessionRecord, ttl time.Duration) error {
+	data, err := encodeSessionRecord(record)
+	if err != nil {
+		return err
+	}
+
+	if ttl <= 0 {
+		ttl = cache.NoExpiration
+	}
+
+	ms.cache.Set(id, data, ttl)
+	return nil
+}
+
+func (ms *memorySessionStore) Delete(id string) error {
+	ms.cache.Delete(id)
+	return nil
+}
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FileSessionStore keeps every session in its own file in the directory.
+type FileSessionStore struct {
+	dir string
+}
+
+// fileSession is the content of session file
+type fileSession struct {
+	Record  []byte
+	Expires time.Time
+}
+
+// Create file session store in dir, the directory is created when missing.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (fs *FileSessionStore) path(id string) (string, error) {
+	if !sessionIDPattern.MatchString(id) {
+		return "", errors.New("invalid session id")
+	}
+	return filepath.Join(fs.dir, id+".session"), nil
+}
+
+func (fs *FileSessionStore) Load(id string) (*SessionRecord, error) {
+	path, err := fs.path(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	session, err := readSessionFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.Expires.IsZero() && time.Now().After(session.Expires) {
+		os.Remove(path)
+		return nil, nil
+	}
+
+	return decodeSessionRecord(session.Record)
+}
+
+func (fs *FileSessionStore) Save(id string, record *SessionRecord, ttl time.Duration) error {
+	path, err := fs.path(id)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeSessionRecord(record)
+	if err != nil {
+		return err
+	}
+
+	session := fileSession{Record: data}
+	if ttl > 0 {
+		session.Expires = time.Now().Add(ttl)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session); err != nil {
+		return err
+	}
+
+	// Write to temp file and rename so readers never see partial session
+	tmp, err := os.CreateTemp(fs.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (fs *FileSessionStore) Delete(id string) error {
+	path, err := fs.path(id)
+	if err != nil {
+		return nil
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Cleanup removes the expired session files, call it periodically.
+func (fs *FileSessionStore) Cleanup() error {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".session") {
+			continue
+		}
+
+		path := filepath.Join(fs.dir, entry.Name())
+		session, err := readSessionFile(path)
+		if err != nil || (!session.Expires.IsZero() && now.After(session.Expires)) {
+			os.Remove(path)
+		}
+	}
+
+	return nil
+}
+
+func readSessionFile(path string) (*fileSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	session := new(fileSession)
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
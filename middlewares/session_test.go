@@ -0,0 +1,174 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+var sessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// sessionHandler counts visits in the session, "login" regenerates and "logout" destroys the session
+func sessionHandler(request *request.Request) responses.Response {
+	session := request.Session()
+
+	switch request.HTTPRequest.URL.Path {
+	case "/login":
+		session.Regenerate()
+		session.Set("user", "yoyo")
+	case "/logout":
+		session.Destroy()
+	case "/visit":
+		visits, _ := session.Get("visits")
+		count, _ := visits.(int)
+		session.Set("visits", count+1)
+	}
+
+	user, _ := session.Get("user")
+	visits, _ := session.Get("visits")
+	return responses.NewHTMLResponse(fmt.Sprintf("%v %v", user, visits), http.StatusOK)
+}
+
+// sessionRequest sends request with the cookie and returns the response body and the new cookie
+func sessionRequest(handler AppHandler, path string, cookie string) (string, string) {
+	httpRequest := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != "" {
+		httpRequest.Header.Set("Cookie", cookie)
+	}
+
+	response := handler(request.NewRequest(httpRequest))
+	setCookie := response.Headers().Get("Set-Cookie")
+	if setCookie != "" {
+		cookie, _, _ = strings.Cut(setCookie, ";")
+	}
+
+	return string(response.ToBytes()), cookie
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	fileStore, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]SessionOptions{
+		"cookie":           {SigningKey: sessionKey},
+		"encrypted cookie": {SigningKey: sessionKey, EncryptionKey: sessionKey},
+		"memory store":     {SigningKey: sessionKey, Store: NewMemorySessionStore(time.Minute)},
+		"file store":       {SigningKey: sessionKey, Store: fileStore},
+	}
+
+	for name, options := range stores {
+		sm, err := NewSessionMiddleware(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := sm.Apply(sessionHandler)
+
+		if _, cookie := sessionRequest(handler, "/", ""); cookie != "" {
+			t.Errorf("%s: expecting no session cookie for unused session got %s", name, cookie)
+		}
+
+		_, cookie := sessionRequest(handler, "/visit", "")
+		body, cookie := sessionRequest(handler, "/visit", cookie)
+		if body != "<nil> 2" {
+			t.Errorf("%s: expecting 2 visits got %s", name, body)
+		}
+
+		if options.EncryptionKey != nil && strings.Contains(cookie, "visits") {
+			t.Errorf("%s: expecting encrypted cookie got %s", name, cookie)
+		}
+
+		body, _ = sessionRequest(handler, "/", cookie[:len(cookie)-2]+"xx")
+		if body != "<nil> <nil>" {
+			t.Errorf("%s: expecting tampered cookie to be ignored got %s", name, body)
+		}
+
+		oldCookie := cookie
+		body, cookie = sessionRequest(handler, "/login", cookie)
+		if body != "yoyo 2" || cookie == oldCookie {
+			t.Errorf("%s: expecting regenerated session with the values got %s", name, body)
+		}
+
+		if options.Store != nil {
+			if body, _ := sessionRequest(handler, "/", oldCookie); body != "<nil> <nil>" {
+				t.Errorf("%s: expecting old session id to be invalid got %s", name, body)
+			}
+		}
+
+		_, cookie = sessionRequest(handler, "/logout", cookie)
+		if cookie != "session=" {
+			t.Errorf("%s: expecting expired cookie got %s", name, cookie)
+		}
+	}
+}
+
+func TestSessionMiddlewareExpiry(t *testing.T) {
+	sm, _ := NewSessionMiddleware(SessionOptions{
+		SigningKey:  sessionKey,
+		Store:       NewMemorySessionStore(time.Minute),
+		IdleTimeout: 100 * time.Millisecond,
+	})
+	handler := sm.Apply(sessionHandler)
+
+	_, cookie := sessionRequest(handler, "/visit", "")
+	time.Sleep(20 * time.Millisecond)
+	body, cookie := sessionRequest(handler, "/visit", cookie)
+	if body != "<nil> 2" {
+		t.Errorf("expecting active session got %s", body)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if body, _ := sessionRequest(handler, "/", cookie); body != "<nil> <nil>" {
+		t.Errorf("expecting idle session to expire got %s", body)
+	}
+
+	sm, _ = NewSessionMiddleware(SessionOptions{SigningKey: sessionKey, AbsoluteTimeout: 100 * time.Millisecond})
+	handler = sm.Apply(sessionHandler)
+
+	_, cookie = sessionRequest(handler, "/visit", "")
+	time.Sleep(200 * time.Millisecond)
+	if body, _ := sessionRequest(handler, "/", cookie); body != "<nil> <nil>" {
+		t.Errorf("expecting session to expire after the absolute timeout got %s", body)
+	}
+
+	// Regenerate keeps the creation time of the session
+	_, cookie = sessionRequest(handler, "/visit", "")
+	time.Sleep(60 * time.Millisecond)
+	_, cookie = sessionRequest(handler, "/login", cookie)
+	time.Sleep(60 * time.Millisecond)
+	if body, _ := sessionRequest(handler, "/", cookie); body != "<nil> <nil>" {
+		t.Errorf("expecting regenerated session to expire after the absolute timeout got %s", body)
+	}
+}
+
+func TestSessionMiddlewareCacheHeaders(t *testing.T) {
+	sm, _ := NewSessionMiddleware(SessionOptions{SigningKey: sessionKey})
+	handler := sm.Apply(sessionHandler)
+
+	response := handler(request.NewRequest(httptest.NewRequest(http.MethodGet, "/visit", nil)))
+	if response.Headers().Get("Set-Cookie") == "" || response.Headers().Get("Cache-Control") != "private, no-store" || response.Headers().Get("Vary") != "Cookie" {
+		t.Errorf("expecting session response to be private got %v", response.Headers())
+	}
+
+	response = handler(request.NewRequest(httptest.NewRequest(http.MethodGet, "/", nil)))
+	if response.Headers().Get("Cache-Control") != "" || response.Headers().Get("Vary") != "" {
+		t.Errorf("expecting no cache headers without session cookie got %v", response.Headers())
+	}
+}
+
+func TestSessionMiddlewareKeys(t *testing.T) {
+	if _, err := NewSessionMiddleware(SessionOptions{SigningKey: []byte("short")}); err == nil {
+		t.Errorf("expecting error for short signing key")
+	}
+
+	if _, err := NewSessionMiddleware(SessionOptions{SigningKey: sessionKey, EncryptionKey: []byte("bad")}); err == nil {
+		t.Errorf("expecting error for invalid encryption key")
+	}
+}
@@ -2,37 +2,114 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"runtime/debug"
 	"time"
 
 	"github.com/hvuhsg/goapi/request"
 	"github.com/hvuhsg/goapi/responses"
 )
 
+// TimeoutMiddleware limits the time the view has to respond.
+//
+// The deadline is added to the context of the incoming request, so the view is notified
+// both on timeout and on client disconnect through request.HTTPRequest.Context().
+// The view runs on its own copy of the request, results returned after the timeout are discarded.
+//
+// A TimeoutMiddleware applied on a view overrides the one applied on the app.
 type TimeoutMiddleware struct {
 	Timeout time.Duration
+
+	// Response returned on timeout, defaults to 504 "Request timed out".
+	Response func(request *request.Request) responses.Response
+}
+
+// Marks requests that already got a deadline from an outer TimeoutMiddleware
+type timeoutOverrideKey struct{}
+
+// ViewPanic is the panic value of the view re-raised on the request goroutine by TimeoutMiddleware,
+// Stack is the stack trace of the view goroutine. The app recovery reports the original value with this stack.
+type ViewPanic struct {
+	Value any
+	Stack []byte
+}
+
+func (p *ViewPanic) String() string {
+	return fmt.Sprint(p.Value)
+}
+
+type handlerResult struct {
+	response responses.Response
+	panicked *ViewPanic
 }
 
 func (tm TimeoutMiddleware) Apply(next AppHandler) AppHandler {
 	return func(request *request.Request) responses.Response {
-		// Create a context with a timeout
-		ctx, cancel := context.WithTimeout(context.Background(), tm.Timeout)
+		parent := request.Context()
+
+		// Outer (view level) timeout overrides this one
+		if parent.Value(timeoutOverrideKey{}) != nil {
+			return next(request)
+		}
+
+		ctx, cancel := context.WithTimeout(context.WithValue(parent, timeoutOverrideKey{}, true), tm.Timeout)
 		defer cancel()
 
-		// Add context to the request
-		request.HTTPRequest = request.HTTPRequest.WithContext(ctx)
+		// The view gets its own copy of the request so late writes don't race with the caller
+		viewRequest := *request
+		viewRequest.SetContext(ctx)
+		viewRequest.Parameters = make(map[string]any, len(request.Parameters))
+		for k, v := range request.Parameters {
+			viewRequest.Parameters[k] = v
+		}
 
-		// Use a goroutine to execute the request and wait for it to complete or timeout
-		ch := make(chan responses.Response, 1)
+		// Buffered so the view goroutine never blocks after timeout
+		ch := make(chan handlerResult, 1)
 		go func() {
-			ch <- next(request)
+			defer func() {
+				if r := recover(); r != nil {
+					ch <- handlerResult{panicked: &ViewPanic{Value: r, Stack: debug.Stack()}}
+				}
+			}()
+
+			ch <- handlerResult{response: next(&viewRequest)}
 		}()
 
 		select {
-		case response := <-ch:
-			return response
+		case result := <-ch:
+			if result.panicked != nil {
+				// Used by net/http to abort the response, must be re-raised as is
+				if result.panicked.Value == http.ErrAbortHandler {
+					panic(http.ErrAbortHandler)
+				}
+
+				// Re-panic on the request goroutine so the view recovery handles it
+				panic(result.panicked)
+			}
+			return result.response
 		case <-ctx.Done():
+			go discardLateResult(request, ch)
+
+			if errors.Is(parent.Err(), context.Canceled) {
+				return responses.NewErrorResponse("Client closed request", 499)
+			}
+
+			if tm.Response != nil {
+				return tm.Response(request)
+			}
+
 			return responses.NewHTMLResponse("Request timed out", http.StatusGatewayTimeout)
 		}
 	}
 }
+
+// discardLateResult waits for the view to finish after timeout and logs panics that would be lost otherwise
+func discardLateResult(request *request.Request, ch <-chan handlerResult) {
+	result := <-ch
+	if result.panicked != nil {
+		log.Printf("ERROR: %s %s panicked after timeout: %v\n%s", request.HTTPRequest.Method, request.HTTPRequest.URL.Path, result.panicked.Value, result.panicked.Stack)
+	}
+}
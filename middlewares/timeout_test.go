@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+)
+
+func sleepingHandler(duration time.Duration) AppHandler {
+	return func(request *request.Request) responses.Response {
+		select {
+		case <-time.After(duration):
+			request.Parameters["late"] = true
+			return responses.NewHTMLResponse("done", http.StatusOK)
+		case <-request.HTTPRequest.Context().Done():
+			return responses.NewHTMLResponse("cancelled", http.StatusOK)
+		}
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handler := TimeoutMiddleware{Timeout: 20 * time.Millisecond}.Apply(sleepingHandler(time.Second))
+	response := handler(cacheRequest(http.MethodGet, "/", nil))
+	if response.StatusCode() != http.StatusGatewayTimeout {
+		t.Errorf("expecting status-code 504 got %d", response.StatusCode())
+	}
+
+	handler = TimeoutMiddleware{Timeout: time.Second}.Apply(sleepingHandler(time.Millisecond))
+	response = handler(cacheRequest(http.MethodGet, "/", nil))
+	if string(response.ToBytes()) != "done" {
+		t.Errorf("expecting view response got '%s'", response.ToBytes())
+	}
+}
+
+func TestTimeoutMiddlewareOverride(t *testing.T) {
+	appTimeout := TimeoutMiddleware{Timeout: 10 * time.Millisecond}
+	viewTimeout := TimeoutMiddleware{
+		Timeout: time.Second,
+		Response: func(request *request.Request) responses.Response {
+			return responses.NewJSONResponse(responses.Json{"error": "timeout"}, http.StatusServiceUnavailable)
+		},
+	}
+
+	// View middlewares wrap the app middlewares
+	handler := viewTimeout.Apply(appTimeout.Apply(sleepingHandler(50 * time.Millisecond)))
+	response := handler(cacheRequest(http.MethodGet, "/", nil))
+	if string(response.ToBytes()) != "done" {
+		t.Errorf("expecting view timeout to override app timeout got '%s'", response.ToBytes())
+	}
+
+	viewTimeout.Timeout = 10 * time.Millisecond
+	handler = viewTimeout.Apply(appTimeout.Apply(sleepingHandler(time.Second)))
+	response = handler(cacheRequest(http.MethodGet, "/", nil))
+	if response.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("expecting custom timeout response got %d", response.StatusCode())
+	}
+}
+
+func TestTimeoutMiddlewareClientDisconnect(t *testing.T) {
+	handler := TimeoutMiddleware{Timeout: time.Second}.Apply(func(request *request.Request) responses.Response {
+		time.Sleep(100 * time.Millisecond)
+		return responses.NewHTMLResponse("done", http.StatusOK)
+	})
+
+	req := cacheRequest(http.MethodGet, "/", nil)
+	ctx, cancel := context.WithCancel(req.HTTPRequest.Context())
+	req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+	cancel()
+
+	response := handler(req)
+	if response.StatusCode() != 499 {
+		t.Errorf("expecting client closed request status got %d", response.StatusCode())
+	}
+}
+
+func TestTimeoutMiddlewarePanic(t *testing.T) {
+	handler := TimeoutMiddleware{Timeout: time.Second}.Apply(func(request *request.Request) responses.Response {
+		panic("boom")
+	})
+
+	defer func() {
+		viewPanic, ok := recover().(*ViewPanic)
+		if !ok || viewPanic.Value != "boom" {
+			t.Errorf("expecting view panic to be propagated got %v", viewPanic)
+			return
+		}
+
+		// The stack is the one of the view goroutine
+		if !strings.Contains(string(viewPanic.Stack), "TestTimeoutMiddlewarePanic.func1") {
+			t.Errorf("expecting stack of the view got %s", viewPanic.Stack)
+		}
+	}()
+
+	handler(cacheRequest(http.MethodGet, "/", nil))
+}
@@ -1,15 +1,18 @@
 package goapi
 
 import (
-	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/hvuhsg/goapi/validators"
+	"github.com/invopop/yaml"
 )
 
-// openapi3Schema generates the OpenAPI-3 schema for the given App
-func openapi3Schema(a *App) ([]byte, error) {
+// openapi3Document generates the OpenAPI-3 document for the given App
+func openapi3Document(a *App) *openapi3.T {
 	paths := make(openapi3.Paths)
 
 	// Loop through each view defined in the app
@@ -44,7 +47,7 @@ func openapi3Schema(a *App) ([]byte, error) {
 				// Create a new Parameter object and add it to the Parameters array
 				paramRef := openapi3.ParameterRef{Value: &openapi3.Parameter{
 					Name:       paramName,
-					In:         paramInfo.in,
+					In:         strings.ToLower(paramInfo.in), // OpenAPI locations are lowercase (COOKIE)
 					Required:   required,
 					Schema:     openapi3.NewSchemaRef("", schemaVal),
 					Deprecated: false,
@@ -58,13 +61,41 @@ func openapi3Schema(a *App) ([]byte, error) {
 			respDesc := "Error when validating request against validators"
 			responses["422"] = &openapi3.ResponseRef{Value: &openapi3.Response{Description: &respDesc}}
 
+			// Set authentication error responses for secured views
+			security, optionalSecurity := a.security, a.optionalSecurity
+			if view.hasSecurity() {
+				security, optionalSecurity = view.security, view.optionalSecurity
+			}
+
+			if len(security) > 0 && !optionalSecurity {
+				authDesc := "Authentication is required"
+				responses["401"] = &openapi3.ResponseRef{Value: &openapi3.Response{Description: &authDesc}}
+
+				for _, requirement := range security {
+					if len(requirement.scopes) > 0 {
+						scopesDesc := "Missing required scopes"
+						responses["403"] = &openapi3.ResponseRef{Value: &openapi3.Response{Description: &scopesDesc}}
+					}
+				}
+			}
+
 			// Create a new Operation object to hold all the information for the HTTP method
 			operation := openapi3.Operation{
-				Description: view.description,
-				Tags:        view.tags,
-				Parameters:  parameters,
-				Responses:   responses,
-				Deprecated:  view.depreceted,
+				Summary:      view.summary,
+				OperationID:  view.operationIDFor(method),
+				ExternalDocs: view.externalDocs,
+				Extensions:   view.extensions,
+				Description:  view.description,
+				Tags:         view.tags,
+				Parameters:   parameters,
+				Responses:    responses,
+				Deprecated:   view.depreceted,
+			}
+
+			// View security overrides the app security
+			if view.hasSecurity() {
+				viewSecurity := openapiSecurityRequirements(view.security, view.optionalSecurity)
+				operation.Security = &viewSecurity
 			}
 
 			path.SetOperation(method, &operation)
@@ -73,30 +104,96 @@ func openapi3Schema(a *App) ([]byte, error) {
 		paths[view.path] = path
 	}
 
+	// Different paths can have the same default operation id (/users/profile, /users_profile)
+	uniqueOperationIDs(a, paths)
+
+	// Describe the security schemes of the app and views providers
+	securitySchemes := make(openapi3.SecuritySchemes)
+	requirements := append([]securityRequirement{}, a.security...)
+	for _, view := range a.views {
+		requirements = append(requirements, view.security...)
+	}
+
+	for _, requirement := range requirements {
+		if schemeProvider, ok := requirement.provider.(SecuritySchemeProvider); ok {
+			securitySchemes[requirement.provider.GetName()] = &openapi3.SecuritySchemeRef{Value: schemeProvider.GetSecurityScheme()}
+		}
+	}
+
 	// Create the final OpenAPI-3 schema object with the Paths object and other app information
 	schemaObj := openapi3.T{
-		OpenAPI: "3.0.0",
+		Extensions: a.extensions,
+		OpenAPI:    "3.0.0",
 		Info: &openapi3.Info{
 			Title:          a.title,
 			Version:        a.version,
 			Description:    a.description,
-			License:        &a.license,
 			TermsOfService: a.termOfServiceURL,
-			Contact:        &a.contact,
 		},
-		Security: a.security,
-		Tags:     a.tags,
-		Paths:    paths,
+		Components: &openapi3.Components{SecuritySchemes: securitySchemes},
+		Servers:    a.servers,
+		Security:   openapiSecurityRequirements(a.security, a.optionalSecurity),
+		Tags:       a.tags,
+		Paths:      paths,
+	}
+
+	// Empty license is invalid, the license name is required
+	if a.license.Name != "" {
+		schemaObj.Info.License = &a.license
+	}
+	if a.contact.Name != "" || a.contact.URL != "" || a.contact.Email != "" {
+		schemaObj.Info.Contact = &a.contact
 	}
 
-	// Marshal the OpenAPI-3 schema object to JSON and return it
-	return schemaObj.MarshalJSON()
+	return &schemaObj
 }
 
-func registerDocs(a *App, mux *http.ServeMux) {
-	// Docs internal view, retunrs the OpenAPI-3 schmea
-	schema, schemaErr := openapi3Schema(a) // Only marshel on startup for performence
-	mux.HandleFunc(a.openapiSchemaURL, func(w http.ResponseWriter, r *http.Request) {
+// OpenAPI returns the OpenAPI-3 document of the app, generated from the views on each call.
+// The document uses the 3.0 model, the OpenAPIVersion applies to the served and written schemas.
+func (a *App) OpenAPI() *openapi3.T {
+	return openapi3Document(a)
+}
+
+// openapi3Schema marshals the OpenAPI-3 document to JSON in the app OpenAPI version
+func openapi3Schema(a *App) ([]byte, error) {
+	schema, err := openapi3Document(a).MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	return convertSchemaVersion(schema, a.openapiVersion)
+}
+
+// openapi3YAMLSchema marshals the OpenAPI-3 document to YAML
+func openapi3YAMLSchema(a *App) ([]byte, error) {
+	schema, err := openapi3Schema(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.JSONToYAML(schema)
+}
+
+// WriteOpenAPI writes the OpenAPI-3 document to path, as YAML for .yaml and .yml files and as JSON otherwise.
+func (a *App) WriteOpenAPI(path string) error {
+	var schema []byte
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		schema, err = openapi3YAMLSchema(a)
+	default:
+		schema, err = openapi3Schema(a)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, schema, 0644)
+}
+
+func schemaHandler(schema []byte, schemaErr error, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 			return
@@ -107,44 +204,18 @@ func registerDocs(a *App, mux *http.ServeMux) {
 			return
 		}
 
-		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Content-Type", contentType)
 		w.Write(schema)
-	})
-
-	mux.HandleFunc(a.openapiDocsURL, func(w http.ResponseWriter, _ *http.Request) {
-		swaggerJsUrl := "https://cdn.jsdelivr.net/npm/swagger-ui-dist@3/swagger-ui-bundle.js"
-		swaggerCssUrl := "https://cdn.jsdelivr.net/npm/swagger-ui-dist@3/swagger-ui.css"
-		swaggerFavIconUrl := "https://fastapi.tiangolo.com/img/favicon.png"
-		html := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-		<link type="text/css" rel="stylesheet" href="%s">
-		<link rel="shortcut icon" href="%s">
-		<title>%s</title>
-		</head>
-		<body>
-		<div id="swagger-ui">
-		</div>
-		<script src="%s"></script>
-		<script>
-		const ui = SwaggerUIBundle({
-			url: '%s',
-			dom_id: '#swagger-ui',
-			presets: [
-				SwaggerUIBundle.presets.apis,
-				SwaggerUIBundle.SwaggerUIStandalonePreset
-			],
-			layout: "BaseLayout",
-			deepLinking: true,
-			showExtensions: true,
-			showCommonExtensions: true
-		})
-		</script>
-		</body>
-		</html>
-		`, swaggerCssUrl, swaggerFavIconUrl, a.title, swaggerJsUrl, a.openapiSchemaURL)
-		w.Header().Add("Content-Type", "text/html")
-		w.Write([]byte(html))
-	})
+	}
+}
+
+func registerDocs(a *App, mux *http.ServeMux) {
+	// Docs internal view, retunrs the OpenAPI-3 schmea
+	schema, schemaErr := openapi3Schema(a) // Only marshel on startup for performence
+	mux.Handle(a.openapiSchemaURL, a.protectDocs(schemaHandler(schema, schemaErr, "application/json")))
+
+	yamlSchema, yamlSchemaErr := openapi3YAMLSchema(a)
+	mux.Handle(a.openapiYAMLSchemaURL, a.protectDocs(schemaHandler(yamlSchema, yamlSchemaErr, "application/yaml")))
+
+	registerDocsUIs(a, mux)
 }
@@ -0,0 +1,226 @@
+package goapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OpenAPI versions of the generated schema
+const (
+	OpenAPI30 = "3.0.0"
+	OpenAPI31 = "3.1.0"
+)
+
+// JSON Schema 2020-12 keywords without OpenAPI 3.0 equivalent, removed from 3.0 schemas
+var jsonSchema2020Keywords = []string{
+	"$schema", "$id", "$anchor", "$defs", "$comment", "$dynamicRef", "$dynamicAnchor",
+	"prefixItems", "contains", "minContains", "maxContains", "unevaluatedItems", "unevaluatedProperties",
+	"dependentRequired", "dependentSchemas", "propertyNames", "if", "then", "else",
+	"contentEncoding", "contentMediaType", "contentSchema",
+}
+
+// Security scheme type added in 3.1, removed from 3.0 schemas
+const mutualTLSSchemeType = "mutualTLS"
+
+// OpenAPIVersion sets the OpenAPI version of the schema, OpenAPI30 or OpenAPI31.
+// default to OpenAPI30.
+//
+// Validators set JSON Schema 2020-12 keywords that openapi3.Schema lacks (const, examples, prefixItems, ...)
+// in schema.Extensions, the keywords are converted to their 3.0 equivalent or removed in 3.0 schemas.
+func (a *App) OpenAPIVersion(version string) {
+	if version != OpenAPI30 && version != OpenAPI31 {
+		panic(fmt.Sprintf("unsupported openapi version %s", version))
+	}
+
+	a.openapiVersion = version
+}
+
+// convertSchemaVersion converts the marshaled OpenAPI 3.0 document to the version
+func convertSchemaVersion(data []byte, version string) ([]byte, error) {
+	// Keep the numbers as they are, float64 loses precision of big integers
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	convert := schemaTo30
+	if version == OpenAPI31 {
+		convert = schemaTo31
+	}
+
+	document["openapi"] = version
+	walkDocument(document, convert)
+	if version == OpenAPI30 {
+		removeMutualTLS(document)
+	}
+
+	return json.Marshal(document)
+}
+
+// walkDocument calls convert on every schema of the document
+func walkDocument(node interface{}, convert func(map[string]interface{})) {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			switch {
+			case key == "schema":
+				walkSchema(child, convert)
+			case key == "schemas":
+				if schemas, ok := child.(map[string]interface{}); ok {
+					for _, schema := range schemas {
+						walkSchema(schema, convert)
+					}
+				}
+			case key == "example" || key == "examples" || strings.HasPrefix(key, "x-"):
+				// User values, not part of the document structure
+			default:
+				walkDocument(child, convert)
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			walkDocument(child, convert)
+		}
+	}
+}
+
+// walkSchema calls convert on the schema and its sub schemas
+func walkSchema(node interface{}, convert func(map[string]interface{})) {
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for _, key := range []string{"items", "not", "additionalProperties", "contains", "if", "then", "else"} {
+		walkSchema(schema[key], convert)
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf", "prefixItems"} {
+		if schemas, ok := schema[key].([]interface{}); ok {
+			for _, child := range schemas {
+				walkSchema(child, convert)
+			}
+		}
+	}
+
+	for _, key := range []string{"properties", "patternProperties", "$defs"} {
+		if schemas, ok := schema[key].(map[string]interface{}); ok {
+			for _, child := range schemas {
+				walkSchema(child, convert)
+			}
+		}
+	}
+
+	convert(schema)
+}
+
+// schemaTo31 converts OpenAPI 3.0 schema keywords to JSON Schema 2020-12
+func schemaTo31(schema map[string]interface{}) {
+	// Schemas without type already accept null
+	if nullable, _ := schema["nullable"].(bool); nullable {
+		if schemaType, ok := schema["type"].(string); ok {
+			schema["type"] = []interface{}{schemaType, "null"}
+		}
+	}
+	delete(schema, "nullable")
+
+	if example, ok := schema["example"]; ok {
+		if _, ok := schema["examples"]; !ok {
+			schema["examples"] = []interface{}{example}
+		}
+		delete(schema, "example")
+	}
+
+	// Boolean exclusive bounds are numeric in 2020-12
+	for bound, exclusive := range map[string]string{"minimum": "exclusiveMinimum", "maximum": "exclusiveMaximum"} {
+		isExclusive, ok := schema[exclusive].(bool)
+		if !ok {
+			continue
+		}
+
+		delete(schema, exclusive)
+		if value, ok := schema[bound]; ok && isExclusive {
+			schema[exclusive] = value
+			delete(schema, bound)
+		}
+	}
+}
+
+// schemaTo30 converts JSON Schema 2020-12 keywords set by validators to OpenAPI 3.0
+func schemaTo30(schema map[string]interface{}) {
+	if value, ok := schema["const"]; ok {
+		if _, ok := schema["enum"]; !ok {
+			schema["enum"] = []interface{}{value}
+		}
+		delete(schema, "const")
+	}
+
+	if examples, ok := schema["examples"].([]interface{}); ok {
+		if _, ok := schema["example"]; !ok && len(examples) > 0 {
+			schema["example"] = examples[0]
+		}
+		delete(schema, "examples")
+	}
+
+	for _, keyword := range jsonSchema2020Keywords {
+		delete(schema, keyword)
+	}
+}
+
+// removeMutualTLS removes the mutualTLS security schemes and the requirements using them,
+// 3.0 can't describe client certificate authentication.
+func removeMutualTLS(document map[string]interface{}) {
+	components, _ := document["components"].(map[string]interface{})
+	schemes, _ := components["securitySchemes"].(map[string]interface{})
+
+	removed := make(map[string]bool)
+	for name, scheme := range schemes {
+		if scheme, ok := scheme.(map[string]interface{}); ok && scheme["type"] == mutualTLSSchemeType {
+			delete(schemes, name)
+			removed[name] = true
+		}
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+
+	removeSecurityRequirements(document, removed)
+	paths, _ := document["paths"].(map[string]interface{})
+	for _, path := range paths {
+		path, _ := path.(map[string]interface{})
+		for _, operation := range path {
+			if operation, ok := operation.(map[string]interface{}); ok {
+				removeSecurityRequirements(operation, removed)
+			}
+		}
+	}
+}
+
+// removeSecurityRequirements removes the security requirements of the object that use the schemes
+func removeSecurityRequirements(object map[string]interface{}, schemes map[string]bool) {
+	requirements, ok := object["security"].([]interface{})
+	if !ok {
+		return
+	}
+
+	kept := make([]interface{}, 0, len(requirements))
+	for _, requirement := range requirements {
+		used := false
+		if requirement, ok := requirement.(map[string]interface{}); ok {
+			for name := range requirement {
+				used = used || schemes[name]
+			}
+		}
+		if !used {
+			kept = append(kept, requirement)
+		}
+	}
+
+	object["security"] = kept
+}
@@ -0,0 +1,417 @@
+package goapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hvuhsg/goapi"
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+	"github.com/hvuhsg/goapi/validators"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// vNullableLevel documents nullable level between 1 and 5 with JSON Schema 2020-12 keywords
+type vNullableLevel struct{}
+
+func (vNullableLevel) Validate(*request.Request, string) error { return nil }
+
+func (vNullableLevel) UpdateOpenAPISchema(schema *openapi3.Schema) {
+	schema.Type = "integer"
+	schema.Nullable = true
+	schema.Example = 3
+	schema.Min = openapi3.Float64Ptr(1)
+	schema.Max = openapi3.Float64Ptr(5)
+	schema.ExclusiveMax = true
+	schema.Extensions = map[string]interface{}{"const": 3}
+}
+
+// vPoint documents [x, y] tuple
+type vPoint struct{}
+
+func (vPoint) Validate(*request.Request, string) error { return nil }
+
+func (vPoint) UpdateOpenAPISchema(schema *openapi3.Schema) {
+	schema.Type = "array"
+	schema.Items = openapi3.NewSchemaRef("", openapi3.NewFloat64Schema())
+	schema.Extensions = map[string]interface{}{
+		"prefixItems": []interface{}{map[string]interface{}{"type": "number", "nullable": true}, map[string]interface{}{"type": "number"}},
+		"examples":    []interface{}{[]interface{}{1, 2}, []interface{}{3, 4}},
+	}
+}
+
+func newVersionedApp(version string) *goapi.App {
+	app := goapi.GoAPI("versions", "1.0")
+	app.OpenAPIVersion(version)
+
+	levels := app.Path("/levels")
+	levels.Methods(goapi.GET)
+	levels.Description("Levels")
+	levels.Parameter("level", goapi.QUERY, validators.VRequired{}, vNullableLevel{})
+	levels.Parameter("point", goapi.QUERY, vPoint{})
+	levels.Action(func(request *request.Request) responses.Response {
+		return responses.NewJSONResponse(responses.Json{}, 200)
+	})
+
+	return app
+}
+
+// parameterSchemas returns the written schema and the parameter schemas of /levels by name
+func parameterSchemas(t *testing.T, app *goapi.App) (string, map[string]map[string]interface{}) {
+	path := filepath.Join(t.TempDir(), "openapi.json")
+	if err := app.WriteOpenAPI(path); err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	var document struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name   string                 `json:"name"`
+				Schema map[string]interface{} `json:"schema"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	json.Unmarshal(data, &document)
+
+	schemas := make(map[string]map[string]interface{})
+	for _, parameter := range document.Paths["/levels"]["get"].Parameters {
+		schemas[parameter.Name] = parameter.Schema
+	}
+
+	return path, schemas
+}
+
+func TestOpenAPI30(t *testing.T) {
+	path, schemas := parameterSchemas(t, newVersionedApp(goapi.OpenAPI30))
+
+	document, err := openapi3.NewLoader().LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if err := document.Validate(context.Background()); err != nil {
+		t.Errorf("expecting valid 3.0 document got %s", err)
+	}
+	if document.OpenAPI != "3.0.0" {
+		t.Errorf("expecting openapi 3.0.0 got %s", document.OpenAPI)
+	}
+
+	level := schemas["level"]
+	expected := map[string]interface{}{
+		"type": "integer", "nullable": true, "example": 3.0, "minimum": 1.0, "maximum": 5.0,
+		"exclusiveMaximum": true, "enum": []interface{}{3.0},
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(level[key], value) {
+			t.Errorf("expecting level %s %v got %v", key, value, level[key])
+		}
+	}
+	if _, ok := level["const"]; ok {
+		t.Errorf("expecting const to be converted to enum got %v", level)
+	}
+
+	point := schemas["point"]
+	if _, ok := point["prefixItems"]; ok {
+		t.Errorf("expecting prefixItems to be removed got %v", point)
+	}
+	if !reflect.DeepEqual(point["example"], []interface{}{1.0, 2.0}) || point["examples"] != nil {
+		t.Errorf("expecting examples to be converted to example got %v", point)
+	}
+}
+
+func TestOpenAPI31(t *testing.T) {
+	path, schemas := parameterSchemas(t, newVersionedApp(goapi.OpenAPI31))
+
+	data, _ := os.ReadFile(path)
+	var document map[string]interface{}
+	json.Unmarshal(data, &document)
+	if document["openapi"] != "3.1.0" {
+		t.Errorf("expecting openapi 3.1.0 got %v", document["openapi"])
+	}
+	validateOpenAPI31(t, document)
+
+	level := schemas["level"]
+	expected := map[string]interface{}{
+		"type": []interface{}{"integer", "null"}, "examples": []interface{}{3.0}, "minimum": 1.0,
+		"exclusiveMaximum": 5.0, "const": 3.0,
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(level[key], value) {
+			t.Errorf("expecting level %s %v got %v", key, value, level[key])
+		}
+	}
+	for _, key := range []string{"nullable", "example", "maximum"} {
+		if _, ok := level[key]; ok {
+			t.Errorf("expecting no %s in 3.1 schema got %v", key, level)
+		}
+	}
+
+	point := schemas["point"]
+	prefixItems, _ := point["prefixItems"].([]interface{})
+	if len(prefixItems) != 2 || !reflect.DeepEqual(prefixItems[0], map[string]interface{}{"type": []interface{}{"number", "null"}}) {
+		t.Errorf("expecting converted prefixItems got %v", point["prefixItems"])
+	}
+	if !reflect.DeepEqual(point["examples"], []interface{}{[]interface{}{1.0, 2.0}, []interface{}{3.0, 4.0}}) {
+		t.Errorf("expecting examples array got %v", point["examples"])
+	}
+}
+
+// validateOpenAPI31 validates the document with the OpenAPI 3.1 schema and its schemas with the JSON Schema 2020-12 meta-schema
+func validateOpenAPI31(t *testing.T, document map[string]interface{}) {
+	t.Helper()
+
+	compiler := jsonschema.NewCompiler()
+	documentSchema := compiler.MustCompile("testdata/openapi-3.1-schema.json")
+	metaSchema := compiler.MustCompile("https://json-schema.org/draft/2020-12/schema")
+
+	if err := documentSchema.Validate(document); err != nil {
+		t.Errorf("expecting valid openapi 3.1 document got %#v", err)
+	}
+
+	for path, pathItem := range document["paths"].(map[string]interface{}) {
+		for method, operation := range pathItem.(map[string]interface{}) {
+			parameters, _ := operation.(map[string]interface{})["parameters"].([]interface{})
+			for _, parameter := range parameters {
+				parameter := parameter.(map[string]interface{})
+				if err := metaSchema.Validate(parameter["schema"]); err != nil {
+					t.Errorf("%s %s: expecting valid 2020-12 schema for %s got %#v", method, path, parameter["name"], err)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPIVersionPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expecting panic for unsupported version")
+		}
+	}()
+
+	goapi.GoAPI("versions", "1.0").OpenAPIVersion("2.0")
+}
+
+func TestDocsUIs(t *testing.T) {
+	app := goapi.GoAPI("docs", "1.0")
+	app.Docs(
+		goapi.DocsOptions{UI: goapi.SwaggerUI, Path: "/docs"},
+		goapi.DocsOptions{UI: goapi.ReDoc, Path: "/redoc", ScriptURL: "/static/redoc.js", Config: map[string]interface{}{"hideDownloadButton": true}},
+		goapi.DocsOptions{UI: goapi.RapiDoc, Path: "/rapidoc", ScriptURL: "/static/rapidoc.js"},
+		goapi.DocsOptions{UI: goapi.Scalar, Path: "/scalar", ScriptURL: "/static/scalar.js", Title: "API reference"},
+	)
+	app.DocsSecurity(goapi.NewBasicSecurity("docs", goapi.NewMemoryCredentialStore(map[string]string{"admin": "secret"})))
+
+	go app.Run("127.0.0.1", 8097)
+
+	time.Sleep(time.Millisecond * 200)
+
+	get := func(path string, authenticated bool) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8097"+path, nil)
+		if authenticated {
+			req.SetBasicAuth("admin", "secret")
+		}
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	for _, path := range []string{"/docs", "/openapi.json", "/docs-assets/redoc/redoc.standalone.js"} {
+		if resp, _ := get(path, false); resp.StatusCode != 401 {
+			t.Errorf("%s: expecting status-code 401 without credentials got %d", path, resp.StatusCode)
+		}
+	}
+
+	pages := map[string]string{
+		"/docs":    "/docs-assets/swagger-ui/swagger-ui-bundle.js",
+		"/redoc":   `{"hideDownloadButton":true}`,
+		"/rapidoc": "/static/rapidoc.js",
+		"/scalar":  "<title>API reference</title>",
+	}
+	for path, expected := range pages {
+		resp, body := get(path, true)
+		if resp.StatusCode != 200 || !strings.Contains(body, expected) {
+			t.Errorf("%s: expecting page with '%s' got %d %s", path, expected, resp.StatusCode, body)
+		}
+
+		if strings.Contains(body, "https://") {
+			t.Errorf("%s: expecting no external urls got %s", path, body)
+		}
+	}
+
+	for _, asset := range []string{"/docs-assets/swagger-ui/swagger-ui-bundle.js", "/docs-assets/swagger-ui/swagger-ui.css"} {
+		if resp, body := get(asset, true); resp.StatusCode != 200 || len(body) == 0 {
+			t.Errorf("%s: expecting embedded asset got %d", asset, resp.StatusCode)
+		}
+	}
+
+	for _, asset := range []string{"/docs-assets/assets.txt", "/docs-assets/redoc/redoc.standalone.js"} {
+		if resp, _ := get(asset, true); resp.StatusCode != 404 {
+			t.Errorf("%s: expecting status-code 404 got %d", asset, resp.StatusCode)
+		}
+	}
+}
+
+func TestDocsUIRequiresBundle(t *testing.T) {
+	if _, err := os.Stat("docsui/redoc/redoc.standalone.js"); err == nil {
+		t.Skip("redoc bundle is vendored")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expecting panic for ui that is not embedded without ScriptURL")
+		}
+	}()
+
+	goapi.GoAPI("docs", "1.0").Docs(goapi.DocsOptions{UI: goapi.ReDoc, Path: "/redoc"})
+}
+
+func TestDisableDocs(t *testing.T) {
+	app := goapi.GoAPI("no docs", "1.0")
+	app.DisableDocs()
+
+	go app.Run("127.0.0.1", 8098)
+
+	time.Sleep(time.Millisecond * 200)
+
+	for _, path := range []string{"/docs", "/openapi.json", "/openapi.yaml"} {
+		resp, err := http.Get("http://127.0.0.1:8098" + path)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		if resp.StatusCode != 404 {
+			t.Errorf("%s: expecting status-code 404 got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+// vInvalidType documents invalid schema type
+type vInvalidType struct{}
+
+func (vInvalidType) Validate(*request.Request, string) error { return nil }
+
+func (vInvalidType) UpdateOpenAPISchema(schema *openapi3.Schema) { schema.Type = "int" }
+
+func newValidationApp(parameterValidator validators.Validator) *goapi.App {
+	app := goapi.GoAPI("validation", "1.0")
+
+	items := app.Path("/items")
+	items.Methods(goapi.GET)
+	items.Description("Items")
+	items.Parameter("session", goapi.COOKIE, validators.VIsString{})
+	items.Parameter("count", goapi.QUERY, parameterValidator)
+	items.Action(func(request *request.Request) responses.Response {
+		return responses.NewJSONResponse(responses.Json{}, 200)
+	})
+
+	return app
+}
+
+func TestValidateOpenAPI(t *testing.T) {
+	if err := newValidationApp(validators.VIsInt{}).ValidateOpenAPI(); err != nil {
+		t.Errorf("expecting valid schema got %s", err)
+	}
+
+	// 2020-12 keywords are converted before validating
+	if err := newVersionedApp(goapi.OpenAPI31).ValidateOpenAPI(); err != nil {
+		t.Errorf("expecting valid schema got %s", err)
+	}
+
+	err := newValidationApp(vInvalidType{}).ValidateOpenAPI()
+	if err == nil || !strings.Contains(err.Error(), "view GET /items parameter count") {
+		t.Errorf("expecting error naming the view and parameter got %v", err)
+	}
+}
+
+func TestStrictOpenAPI(t *testing.T) {
+	// Closed listener, Serve fails on accept once the schema is checked
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+
+	app := newValidationApp(vInvalidType{})
+	if err := app.Serve(listener); err == nil || strings.Contains(err.Error(), "parameter count") {
+		t.Errorf("expecting invalid schema to be logged only got %v", err)
+	}
+
+	app = newValidationApp(vInvalidType{})
+	app.StrictOpenAPI()
+	if err := app.Serve(listener); err == nil || !strings.Contains(err.Error(), "parameter count") {
+		t.Errorf("expecting invalid schema error got %v", err)
+	}
+}
+
+// noSchemeSecurity doesn't describe its security scheme
+type noSchemeSecurity struct{}
+
+func (noSchemeSecurity) GetName() string { return "custom" }
+
+func (noSchemeSecurity) GetScopes() []string { return []string{} }
+
+func (noSchemeSecurity) IsAuthenticated(*request.Request) bool { return true }
+
+func TestOpenAPIMutualTLS(t *testing.T) {
+	schemaDocument := func(app *goapi.App) map[string]interface{} {
+		path := filepath.Join(t.TempDir(), "openapi.json")
+		if err := app.WriteOpenAPI(path); err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		var document map[string]interface{}
+		json.Unmarshal(data, &document)
+		return document
+	}
+
+	for _, version := range []string{goapi.OpenAPI30, goapi.OpenAPI31} {
+		app := newValidationApp(validators.VIsInt{})
+		app.OpenAPIVersion(version)
+		app.Security(goapi.NewMTLSSecurity(nil))
+		app.Security(goapi.NewAPISecurity("X-API-Key", "secret"))
+
+		if err := app.ValidateOpenAPI(); err != nil {
+			t.Errorf("%s: expecting valid schema got %s", version, err)
+		}
+
+		document := schemaDocument(app)
+		schemes := document["components"].(map[string]interface{})["securitySchemes"].(map[string]interface{})
+		security := document["security"].([]interface{})
+
+		if version == goapi.OpenAPI30 {
+			if _, ok := schemes["mtls"]; ok || len(security) != 1 {
+				t.Errorf("expecting mutualTLS to be left out of 3.0 schema got %v %v", schemes, security)
+			}
+			continue
+		}
+
+		mtls, _ := schemes["mtls"].(map[string]interface{})
+		if mtls["type"] != "mutualTLS" || len(security) != 2 {
+			t.Errorf("expecting mutualTLS scheme in 3.1 schema got %v %v", schemes, security)
+		}
+		validateOpenAPI31(t, document)
+	}
+
+	app := newValidationApp(validators.VIsInt{})
+	app.Security(noSchemeSecurity{})
+	if err := app.ValidateOpenAPI(); err == nil || !strings.Contains(err.Error(), "security custom has no security scheme") {
+		t.Errorf("expecting error for requirement without scheme got %v", err)
+	}
+}
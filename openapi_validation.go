@@ -0,0 +1,93 @@
+package goapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// StrictOpenAPI makes the Run methods fail when the generated OpenAPI schema is invalid,
+// by default the errors are logged on startup.
+func (a *App) StrictOpenAPI() {
+	a.strictOpenAPI = true
+}
+
+// ValidateOpenAPI validates the generated OpenAPI schema, the errors name the view and parameter
+// with invalid schema (e.g from custom validator UpdateOpenAPISchema).
+// The schema is validated in its 3.0 form, kin-openapi does not support 3.1.
+func (a *App) ValidateOpenAPI() error {
+	data, err := openapi3Document(a).MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	// Convert the 2020-12 keywords set by validators, they are invalid in the 3.0 model
+	data, err = convertSchemaVersion(data, OpenAPI30)
+	if err != nil {
+		return err
+	}
+
+	document, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	errs := make([]error, 0)
+
+	for _, name := range undefinedSecuritySchemes(document, document.Security) {
+		errs = append(errs, fmt.Errorf("security %s has no security scheme", name))
+	}
+
+	for _, path := range sortedKeys(document.Paths) {
+		operations := document.Paths[path].Operations()
+		for _, method := range sortedKeys(operations) {
+			for _, parameter := range operations[method].Parameters {
+				if err := parameter.Value.Validate(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("view %s %s parameter %s: %w", method, path, parameter.Value.Name, err))
+				}
+			}
+
+			if security := operations[method].Security; security != nil {
+				for _, name := range undefinedSecuritySchemes(document, *security) {
+					errs = append(errs, fmt.Errorf("view %s %s security %s has no security scheme", method, path, name))
+				}
+			}
+		}
+	}
+
+	// The parameters errors are clearer, validate the document when they are valid
+	if len(errs) == 0 {
+		if err := document.Validate(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// undefinedSecuritySchemes returns the names of the requirements without security scheme,
+// providers that don't implement SecuritySchemeProvider have no scheme.
+func undefinedSecuritySchemes(document *openapi3.T, requirements openapi3.SecurityRequirements) []string {
+	names := make([]string, 0)
+	for _, requirement := range requirements {
+		for _, name := range sortedKeys(requirement) {
+			if document.Components == nil || document.Components.SecuritySchemes[name] == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
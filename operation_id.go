@@ -0,0 +1,94 @@
+package goapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// operationIDFor returns the OpenAPI operation id of the view method
+func (v *View) operationIDFor(method string) string {
+	if v.operationID == "" {
+		return defaultOperationID(method, v.path)
+	}
+
+	if len(v.methods) == 1 {
+		return v.operationID
+	}
+
+	return strings.ToLower(method) + upperFirst(v.operationID)
+}
+
+// defaultOperationID builds camel case id from the method and the path words,
+// e.g "getUsersProfile" for GET /users/profile and "getRoot" for GET /.
+func defaultOperationID(method string, path string) string {
+	words := strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		words = []string{"root"}
+	}
+
+	id := strings.ToLower(method)
+	for _, word := range words {
+		id += upperFirst(strings.ToLower(word))
+	}
+
+	return id
+}
+
+// uniqueOperationIDs adds numeric suffix to default operation ids that are already used,
+// in sorted path order, e.g "getUsersProfile2" for GET /users/profile when /users-profile exists.
+// Operation ids set with OperationID are kept as they are.
+func uniqueOperationIDs(a *App, paths openapi3.Paths) {
+	used := make(map[string]bool)
+	viewPaths := make([]string, 0, len(a.views))
+	for viewPath, view := range a.views {
+		viewPaths = append(viewPaths, viewPath)
+		if view.operationID == "" {
+			continue
+		}
+
+		for _, method := range view.methods {
+			used[view.operationIDFor(method)] = true
+		}
+	}
+	sort.Strings(viewPaths)
+
+	for _, viewPath := range viewPaths {
+		view := a.views[viewPath]
+		if view.operationID != "" {
+			continue
+		}
+
+		for _, method := range view.methods {
+			operation := paths[view.path].GetOperation(method)
+			id := operation.OperationID
+			for n := 2; used[id]; n++ {
+				id = fmt.Sprintf("%s%d", operation.OperationID, n)
+			}
+
+			used[id] = true
+			operation.OperationID = id
+		}
+	}
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+
+	runes := []rune(s)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func requireExtensionName(name string) {
+	if !strings.HasPrefix(name, "x-") {
+		panic(fmt.Sprintf("extension name %s must start with 'x-'", name))
+	}
+}
@@ -0,0 +1,80 @@
+package goapi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// RunH2C starts the application over HTTP/2 without TLS (h2c), HTTP/1.1 clients are served too.
+// Use it behind proxies and service mesh sidecars that talk h2c, browsers don't support h2c.
+func (a *App) RunH2C(host string, port int) error {
+	handler, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+	a.startup(addr)
+
+	return server.Serve(listener)
+}
+
+// RunHTTP3 starts the application over HTTP/3 (QUIC on UDP) and HTTPS (TCP) on the same port.
+// HTTPS responses advertise HTTP/3 with the Alt-Svc header, so clients switch to HTTP/3 on the next requests.
+func (a *App) RunHTTP3(host string, port int, options TLSOptions) error {
+	handler, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	config, stop, err := NewTLSConfig(options)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	packetConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer packetConn.Close()
+
+	h3Server := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(config), Port: port}
+	server := &http.Server{
+		TLSConfig: config,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h3Server.SetQUICHeaders(w.Header())
+			handler.ServeHTTP(w, r)
+		}),
+	}
+
+	a.startup(addr)
+
+	errs := make(chan error, 2)
+	go func() { errs <- h3Server.Serve(packetConn) }()
+	go func() { errs <- server.ServeTLS(listener, "", "") }()
+
+	// Stop both servers when one of them fails
+	err = <-errs
+	h3Server.Close()
+	server.Close()
+	return err
+}
@@ -0,0 +1,190 @@
+package goapi
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/hvuhsg/goapi/middlewares"
+	"github.com/hvuhsg/goapi/request"
+)
+
+// PanicReport describes a recovered panic, passed to the RecoveryOptions.OnPanic hook.
+type PanicReport struct {
+	Value      any
+	Stack      []byte
+	RequestID  string
+	Method     string
+	URL        string
+	RemoteAddr string
+	Header     http.Header
+	Time       time.Time
+}
+
+// RecoveryOptions configures the panic recovery of the app.
+// Recovery covers the views and the external handlers added with Include.
+type RecoveryOptions struct {
+	// Development mode, respond with a debug page showing the panic and the stack trace.
+	// Never enable in production, the page exposes the request headers and the source paths.
+	Debug bool
+
+	// Called for every recovered panic, use it to report errors (sentry, rollbar, ...).
+	OnPanic func(report *PanicReport)
+
+	// Header with the request id, generated when the client didn't send one.
+	// The id is returned in the same header of the error response.
+	// default to "X-Request-ID".
+	RequestIDHeader string
+}
+
+// Recovery configures the panic recovery.
+func (a *App) Recovery(options RecoveryOptions) {
+	if options.RequestIDHeader == "" {
+		options.RequestIDHeader = "X-Request-ID"
+	}
+
+	a.recovery = options
+}
+
+// recoveryHandler recovers panics of the wrapped handler and responds with the error handler response
+func (a *App) recoveryHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			// Used by net/http to abort the response, must not be recovered
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			report := a.newPanicReport(r, rec)
+			log.Printf("ERROR: panic serving %s %s (request id %s): %v\n%s", report.Method, report.URL, report.RequestID, report.Value, report.Stack)
+
+			if a.recovery.OnPanic != nil {
+				a.recovery.OnPanic(report)
+			}
+
+			// Response already started, nothing to do but closing the connection
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			w.Header().Set(a.recovery.RequestIDHeader, report.RequestID)
+
+			if a.recovery.Debug {
+				writeDebugPage(w, report)
+				return
+			}
+
+			req := &request.Request{HTTPRequest: r, Parameters: make(map[string]any)}
+			writeResponse(w, a.errorHandler(req, &PanicError{Value: report.Value, Stack: report.Stack, RequestID: report.RequestID}))
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (a *App) newPanicReport(r *http.Request, rec any) *PanicReport {
+	requestID := r.Header.Get(a.recovery.RequestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	// Panics of views run by the timeout middleware carry the stack of the view goroutine
+	value, stack := rec, debug.Stack()
+	if viewPanic, ok := rec.(*middlewares.ViewPanic); ok {
+		value, stack = viewPanic.Value, viewPanic.Stack
+	}
+
+	return &PanicReport{
+		Value:      value,
+		Stack:      stack,
+		RequestID:  requestID,
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header.Clone(),
+		Time:       time.Now(),
+	}
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+var debugPageTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>panic: {{.Value}}</title></head>
+<body style="font-family: monospace">
+<h1>panic: {{.Value}}</h1>
+<p>{{.Method}} {{.URL}} from {{.RemoteAddr}} at {{.Time.Format "2006-01-02 15:04:05"}}</p>
+<p>Request ID: {{.RequestID}}</p>
+<h2>Stack trace</h2>
+<pre>{{printf "%s" .Stack}}</pre>
+<h2>Request headers</h2>
+<table>
+{{range $name, $values := .Header}}<tr><td>{{$name}}</td><td>{{range $values}}{{.}} {{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func writeDebugPage(w http.ResponseWriter, report *PanicReport) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	debugPageTemplate.Execute(w, report)
+}
+
+// recoveryResponseWriter tracks if the response was started
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryResponseWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoveryResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *recoveryResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		rw.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (rw *recoveryResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+
+	rw.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (rw *recoveryResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,84 @@
+package request
+
+import (
+	"context"
+	"fmt"
+)
+
+// Context returns the context of the request.
+// The context is canceled when the client disconnects or when a middleware deadline is exceeded.
+func (r *Request) Context() context.Context {
+	if r.HTTPRequest != nil {
+		return r.HTTPRequest.Context()
+	}
+
+	if r.ctx != nil {
+		return r.ctx
+	}
+
+	return context.Background()
+}
+
+// SetContext replace the context of the request, used by middlewares to add deadlines and values.
+func (r *Request) SetContext(ctx context.Context) {
+	if r.HTTPRequest != nil {
+		r.HTTPRequest = r.HTTPRequest.WithContext(ctx)
+		return
+	}
+
+	r.ctx = ctx
+}
+
+// Key type for values set with Set / Get, prevents collisions with context keys of other packages
+type valueKey string
+
+// Set stores request-scoped value, the value is visible to the next middlewares and the view.
+func (r *Request) Set(key string, value any) {
+	r.SetContext(context.WithValue(r.Context(), valueKey(key), value))
+}
+
+// Get returns the request-scoped value stored with Set.
+func (r *Request) Get(key string) (any, bool) {
+	value := r.Context().Value(valueKey(key))
+	return value, value != nil
+}
+
+// Key is a typed key for request-scoped values, every key created with NewKey is unique.
+//
+//	var UserKey = request.NewKey[*User]("user")
+//
+//	request.SetValue(r, UserKey, user) // in the auth middleware
+//	user, ok := request.GetValue(r, UserKey) // in the view
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates new typed key, the name is only used for error messages.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// SetValue stores typed request-scoped value.
+func SetValue[T any](r *Request, key *Key[T], value T) {
+	r.SetContext(context.WithValue(r.Context(), key, value))
+}
+
+// GetValue returns the typed request-scoped value stored with SetValue.
+func GetValue[T any](r *Request, key *Key[T]) (T, bool) {
+	value, ok := r.Context().Value(key).(T)
+	return value, ok
+}
+
+// MustGetValue returns the typed request-scoped value, panics if the value was not set.
+func MustGetValue[T any](r *Request, key *Key[T]) T {
+	value, ok := GetValue(r, key)
+	if !ok {
+		panic(fmt.Sprintf("request value '%s' not found", key.name))
+	}
+
+	return value
+}
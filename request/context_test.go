@@ -0,0 +1,72 @@
+package request
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+type user struct {
+	name string
+}
+
+var userKey = NewKey[*user]("user")
+
+func TestRequestValues(t *testing.T) {
+	req := NewRequest(httptest.NewRequest("GET", "/", nil))
+
+	req.Set("tenant", "acme")
+	tenant, ok := req.Get("tenant")
+	if !ok || tenant != "acme" {
+		t.Errorf("Get returned wrong value: expected 'acme', got '%v'", tenant)
+	}
+
+	if _, ok := req.Get("missing"); ok {
+		t.Errorf("Get found value that was not set")
+	}
+
+	SetValue(req, userKey, &user{name: "yoyo"})
+	u, ok := GetValue(req, userKey)
+	if !ok || u.name != "yoyo" {
+		t.Errorf("GetValue returned wrong value: %v", u)
+	}
+
+	// Values are visible through the request context
+	if req.HTTPRequest.Context().Value(userKey) != u {
+		t.Errorf("value not found in the http request context")
+	}
+
+	// Keys with the same name are different keys
+	otherKey := NewKey[*user]("user")
+	if _, ok := GetValue(req, otherKey); ok {
+		t.Errorf("GetValue found value of a different key")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("MustGetValue did not panic for missing value")
+		}
+	}()
+	MustGetValue(req, otherKey)
+}
+
+func TestRequestContext(t *testing.T) {
+	req := &Request{Parameters: map[string]interface{}{}}
+	if req.Context() != context.Background() {
+		t.Errorf("expecting background context for request without http request")
+	}
+
+	req.Set("a", 1)
+	if a, ok := req.Get("a"); !ok || a != 1 {
+		t.Errorf("Get returned wrong value: expected 1, got '%v'", a)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	httpReq := NewRequest(httptest.NewRequest("GET", "/", nil))
+	httpReq.SetContext(ctx)
+	cancel()
+
+	if httpReq.HTTPRequest.Context().Err() == nil {
+		t.Errorf("expecting http request context to be replaced")
+	}
+}
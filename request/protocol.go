@@ -0,0 +1,24 @@
+package request
+
+// Protocol returns the negotiated HTTP protocol: "http/1.0", "http/1.1", "h2", "h2c" (HTTP/2 without TLS) or "h3".
+func (r *Request) Protocol() string {
+	if r.HTTPRequest == nil {
+		return ""
+	}
+
+	switch r.HTTPRequest.ProtoMajor {
+	case 3:
+		return "h3"
+	case 2:
+		if r.HTTPRequest.TLS == nil {
+			return "h2c"
+		}
+		return "h2"
+	case 1:
+		if r.HTTPRequest.ProtoMinor == 0 {
+			return "http/1.0"
+		}
+	}
+
+	return "http/1.1"
+}
@@ -1,6 +1,7 @@
 package request
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 type Request struct {
 	HTTPRequest *http.Request
 	Parameters  map[string]any
+
+	ctx context.Context // Used only when there is no HTTPRequest
 }
 
 func NewRequest(req *http.Request) *Request {
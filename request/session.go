@@ -0,0 +1,34 @@
+package request
+
+import "context"
+
+// Session is the session of the request, available when the session middleware is used.
+type Session interface {
+	ID() string
+	Get(key string) (any, bool)
+	Set(key string, value any)
+	Delete(key string)
+	Clear()
+
+	// Regenerate replaces the session id and keeps the values,
+	// call it after login or privilege change to prevent session fixation.
+	Regenerate()
+
+	// Destroy removes the session and expires the cookie, call it on logout.
+	// Cookie sessions (without store) can't be revoked, copies of the old cookie
+	// stay valid until the session timeouts, use a store to revoke them.
+	Destroy()
+}
+
+type sessionKey struct{}
+
+// Session returns the session of the request, nil when the session middleware is not used.
+func (r *Request) Session() Session {
+	session, _ := r.Context().Value(sessionKey{}).(Session)
+	return session
+}
+
+// SetSession sets the session of the request, used by the session middleware.
+func (r *Request) SetSession(session Session) {
+	r.SetContext(context.WithValue(r.Context(), sessionKey{}, session))
+}
@@ -0,0 +1,18 @@
+package request
+
+import "crypto/x509"
+
+// ClientCertificate returns the verified client certificate of mutual TLS connections,
+// nil when the client didn't send a certificate or it wasn't verified against the client CAs.
+func (r *Request) ClientCertificate() *x509.Certificate {
+	if r.HTTPRequest == nil || r.HTTPRequest.TLS == nil {
+		return nil
+	}
+
+	chains := r.HTTPRequest.TLS.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil
+	}
+
+	return chains[0][0]
+}
@@ -9,13 +9,13 @@ type errorResponse struct {
 }
 
 func NewErrorResponse(error string, code int) Response {
-	return errorResponse{Error: error, Code: code}
+	headers := http.Header{}
+	headers.Set("Content-Type", "text/plain; charset=utf-8")
+	headers.Set("X-Content-Type-Options", "nosniff")
+	return errorResponse{headers: headers, Error: error, Code: code}
 }
 
 func (er errorResponse) Headers() http.Header {
-	er.headers = http.Header{}
-	er.headers.Set("Content-Type", "text/plain; charset=utf-8")
-	er.headers.Set("X-Content-Type-Options", "nosniff")
 	return er.headers
 }
 
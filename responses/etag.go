@@ -0,0 +1,46 @@
+package responses
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"time"
+)
+
+// NewETag returns a strong entity tag computed from the content.
+func NewETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// NewWeakETag returns a weak entity tag computed from the content,
+// use it for representations that are semantically equivalent but not byte identical (e.g compressed).
+func NewWeakETag(content []byte) string {
+	return "W/" + NewETag(content)
+}
+
+// SetETag sets the ETag header of the response, etag must be quoted (use NewETag / NewWeakETag).
+func SetETag(response Response, etag string) Response {
+	response.Headers().Set("ETag", etag)
+	return response
+}
+
+// SetLastModified sets the Last-Modified header of the response.
+func SetLastModified(response Response, lastModified time.Time) Response {
+	response.Headers().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	return response
+}
+
+// Headers kept in 304 responses (RFC 9110 section 15.4.5)
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"}
+
+// NewNotModifiedResponse creates 304 response with the validators and caching headers of the original response.
+func NewNotModifiedResponse(original Response) Response {
+	response := NewResponse(nil, http.StatusNotModified)
+	for _, header := range notModifiedHeaders {
+		if values := original.Headers().Values(header); len(values) > 0 {
+			response.Headers()[http.CanonicalHeaderKey(header)] = values
+		}
+	}
+	return response
+}
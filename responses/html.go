@@ -9,12 +9,12 @@ type htmlResponse struct {
 }
 
 func NewHTMLResponse(content string, code int) Response {
-	return htmlResponse{Content: content, Code: code}
+	headers := http.Header{}
+	headers.Set("Content-Type", "text/html")
+	return htmlResponse{headers: headers, Content: content, Code: code}
 }
 
 func (hr htmlResponse) Headers() http.Header {
-	hr.headers = http.Header{}
-	hr.headers.Set("Content-Type", "text/html")
 	return hr.headers
 }
 
@@ -0,0 +1,127 @@
+package responses
+
+import (
+	"net/http"
+)
+
+// HTTPError is an error with HTTP status code, returned from views to respond with error.
+// The App error handler renders it as JSON response (see goapi.DefaultErrorHandler).
+type HTTPError struct {
+	Code    int
+	Message string
+	Details any         // Optional, included in the response body
+	Header  http.Header // Optional, added to the response headers (e.g WWW-Authenticate)
+	Err     error       // Optional cause, not exposed to the client
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails sets additional information for the client
+func (e *HTTPError) WithDetails(details any) *HTTPError {
+	e.Details = details
+	return e
+}
+
+// WithHeader adds response header
+func (e *HTTPError) WithHeader(key string, value string) *HTTPError {
+	if e.Header == nil {
+		e.Header = http.Header{}
+	}
+	e.Header.Add(key, value)
+	return e
+}
+
+// Wrap sets the cause of the error
+func (e *HTTPError) Wrap(err error) *HTTPError {
+	e.Err = err
+	return e
+}
+
+// NewHTTPError creates error with status code, empty message defaults to the status text.
+func NewHTTPError(code int, message string) *HTTPError {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: message}
+}
+
+func BadRequest(message string) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, message)
+}
+
+func Unauthorized(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnauthorized, message)
+}
+
+func Forbidden(message string) *HTTPError {
+	return NewHTTPError(http.StatusForbidden, message)
+}
+
+func NotFound(message string) *HTTPError {
+	return NewHTTPError(http.StatusNotFound, message)
+}
+
+func MethodNotAllowed(message string) *HTTPError {
+	return NewHTTPError(http.StatusMethodNotAllowed, message)
+}
+
+func Conflict(message string) *HTTPError {
+	return NewHTTPError(http.StatusConflict, message)
+}
+
+func Gone(message string) *HTTPError {
+	return NewHTTPError(http.StatusGone, message)
+}
+
+func PreconditionFailed(message string) *HTTPError {
+	return NewHTTPError(http.StatusPreconditionFailed, message)
+}
+
+func UnprocessableEntity(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnprocessableEntity, message)
+}
+
+func TooManyRequests(message string) *HTTPError {
+	return NewHTTPError(http.StatusTooManyRequests, message)
+}
+
+func InternalServerError(message string) *HTTPError {
+	return NewHTTPError(http.StatusInternalServerError, message)
+}
+
+func ServiceUnavailable(message string) *HTTPError {
+	return NewHTTPError(http.StatusServiceUnavailable, message)
+}
+
+// NewHTTPErrorResponse renders the error as JSON response
+//
+//	{"code": 404, "error": "Not Found", "message": "user not found", "details": ...}
+func NewHTTPErrorResponse(err *HTTPError) Response {
+	content := Json{
+		"code":    err.Code,
+		"error":   http.StatusText(err.Code),
+		"message": err.Message,
+	}
+
+	if err.Details != nil {
+		content["details"] = err.Details
+	}
+
+	response := NewJSONResponse(content, err.Code)
+	for k, values := range err.Header {
+		for _, value := range values {
+			response.Headers().Add(k, value)
+		}
+	}
+
+	return response
+}
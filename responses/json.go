@@ -14,12 +14,12 @@ type jsonResponse struct {
 }
 
 func NewJSONResponse(content Json, code int) Response {
-	return jsonResponse{Content: content, Code: code}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	return jsonResponse{headers: headers, Content: content, Code: code}
 }
 
 func (jr jsonResponse) Headers() http.Header {
-	jr.headers = http.Header{}
-	jr.headers.Set("Content-Type", "application/json")
 	return jr.headers
 }
 
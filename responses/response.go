@@ -29,5 +29,5 @@ func (r *response) StatusCode() int {
 }
 
 func NewResponse(content []byte, code int) Response {
-	return &response{content: content, code: code}
+	return &response{Header: http.Header{}, content: content, code: code}
 }
@@ -3,28 +3,44 @@ package responses
 import (
 	"bytes"
 	"net/http"
+	"path/filepath"
 	"text/template"
 )
 
+// TemplateResponse is a response rendered from template file,
+// middlewares add per-request template functions (csrfField, cspNonce, ...) with Funcs.
+type TemplateResponse interface {
+	Response
+	Funcs(funcs template.FuncMap)
+}
+
 type templateResponse struct {
 	headers      http.Header
+	funcs        template.FuncMap
 	TemplatePath string
 	Data         any
 	Code         int
 }
 
 func NewTemplateResponse(tmpPath string, data any, code int) Response {
-	return templateResponse{TemplatePath: tmpPath, Data: data, Code: code}
+	headers := http.Header{}
+	headers.Set("Content-Type", "text/html")
+	return templateResponse{headers: headers, funcs: template.FuncMap{}, TemplatePath: tmpPath, Data: data, Code: code}
 }
 
 func (tr templateResponse) Headers() http.Header {
-	tr.headers = http.Header{}
-	tr.headers.Set("Content-Type", "text/html")
 	return tr.headers
 }
 
+// Funcs adds functions to the template, must be called before the response is rendered.
+func (tr templateResponse) Funcs(funcs template.FuncMap) {
+	for name, fn := range funcs {
+		tr.funcs[name] = fn
+	}
+}
+
 func (tr templateResponse) ToBytes() []byte {
-	tpl, err := template.ParseFiles(tr.TemplatePath)
+	tpl, err := template.New(filepath.Base(tr.TemplatePath)).Funcs(tr.funcs).ParseFiles(tr.TemplatePath)
 	if err != nil {
 		panic("Can't parse template: " + err.Error())
 	}
@@ -1,9 +1,13 @@
 package goapi
 
 import (
-	"fmt"
+	"crypto/subtle"
+	"strings"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hvuhsg/goapi/middlewares"
 	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
 )
 
 type SecurityProvider interface {
@@ -12,25 +16,204 @@ type SecurityProvider interface {
 	IsAuthenticated(*request.Request) bool
 }
 
+// SecuritySchemeProvider is implemented by providers that describe their security scheme,
+// the scheme is added to the components/securitySchemes of the OpenAPI schema under the provider name.
+type SecuritySchemeProvider interface {
+	GetSecurityScheme() *openapi3.SecurityScheme
+}
+
+// SecurityChallenger is implemented by providers that tell the client how to authenticate,
+// the challenge is sent in the WWW-Authenticate header of 401 responses to the request.
+type SecurityChallenger interface {
+	GetChallenge(*request.Request) string
+}
+
+var grantedScopesKey = request.NewKey[[]string]("granted-scopes")
+
+// SetGrantedScopes stores the scopes granted to the authenticated request,
+// called by security providers that support scopes (oauth2, jwt, ...) from IsAuthenticated.
+func SetGrantedScopes(r *request.Request, scopes []string) {
+	request.SetValue(r, grantedScopesKey, scopes)
+}
+
+// GetGrantedScopes returns the scopes granted to the request by the security provider that authenticated it.
+func GetGrantedScopes(r *request.Request) []string {
+	scopes, _ := request.GetValue(r, grantedScopesKey)
+	return scopes
+}
+
+// APISecurity authenticates requests with static API keys sent in header, query parameter or cookie.
 type APISecurity struct {
-	apiKey     string
-	headerName string
+	name        string
+	in          string
+	keyName     string
+	apiKeys     []string
+	description string
+}
+
+// NewAPISecurity creates API key security provider with the key in the header.
+func NewAPISecurity(headerName string, apiKey string) *APISecurity {
+	return NewAPIKeySecurity("api-key", HEADER, headerName, apiKey)
+}
+
+// NewAPIKeySecurity creates API key security provider named name,
+// the key is read from keyName in the header, query or cookie (HEADER, QUERY, COOKIE).
+// Any of the apiKeys is accepted, useful for key rotation.
+func NewAPIKeySecurity(name string, in string, keyName string, apiKeys ...string) *APISecurity {
+	return &APISecurity{name: name, in: strings.ToLower(in), keyName: keyName, apiKeys: apiKeys}
 }
 
-func (APISecurity) GetName() string {
-	return "api-key"
+// Description sets the security scheme description, shown in the docs
+func (sec *APISecurity) Description(description string) *APISecurity {
+	sec.description = description
+	return sec
+}
+
+func (sec *APISecurity) GetName() string {
+	return sec.name
 }
 
 func (APISecurity) GetScopes() []string {
 	return []string{}
 }
 
+func (sec *APISecurity) GetSecurityScheme() *openapi3.SecurityScheme {
+	return openapi3.NewSecurityScheme().
+		WithType("apiKey").
+		WithIn(sec.in).
+		WithName(sec.keyName).
+		WithDescription(sec.description)
+}
+
 func (sec *APISecurity) IsAuthenticated(r *request.Request) bool {
-	defer func() {
-		if r := recover(); r != nil {
-			panic(fmt.Sprintf("API Header '%s' not found", sec.headerName))
+	if r.HTTPRequest == nil {
+		return false
+	}
+
+	var key string
+	switch sec.in {
+	case QUERY:
+		key = r.HTTPRequest.URL.Query().Get(sec.keyName)
+	case strings.ToLower(COOKIE):
+		cookie, err := r.HTTPRequest.Cookie(sec.keyName)
+		if err == nil {
+			key = cookie.Value
+		}
+	default:
+		key = r.HTTPRequest.Header.Get(sec.keyName)
+	}
+
+	if key == "" {
+		return false
+	}
+
+	for _, apiKey := range sec.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// securityRequirement is a provider with the scopes required from it
+type securityRequirement struct {
+	provider SecurityProvider
+	scopes   []string
+}
+
+func newSecurityRequirement(provider SecurityProvider, scopes []string) securityRequirement {
+	if len(scopes) == 0 {
+		scopes = provider.GetScopes()
+	}
+	return securityRequirement{provider: provider, scopes: scopes}
+}
+
+// openapiSecurityRequirements converts the requirements into OpenAPI security requirements,
+// optional security is represented by an empty requirement.
+func openapiSecurityRequirements(requirements []securityRequirement, optional bool) openapi3.SecurityRequirements {
+	secRequirements := openapi3.SecurityRequirements{}
+	for _, requirement := range requirements {
+		secRequirements = append(secRequirements, openapi3.NewSecurityRequirement().Authenticate(requirement.provider.GetName(), requirement.scopes...))
+	}
+
+	if optional {
+		secRequirements = append(secRequirements, openapi3.NewSecurityRequirement())
+	}
+
+	return secRequirements
+}
+
+// authorize checks the request against the security requirements, any satisfied requirement is enough.
+// Returns 401 error when no provider authenticated the request and 403 error when the granted scopes are missing.
+// Requests are allowed when there are no requirements or when security is optional.
+func authorize(requirements []securityRequirement, optional bool, r *request.Request) *responses.HTTPError {
+	if len(requirements) == 0 {
+		return nil
+	}
+
+	authenticated := false
+	for _, requirement := range requirements {
+		// Don't let scopes granted by another provider leak into this requirement
+		SetGrantedScopes(r, nil)
+
+		if !requirement.provider.IsAuthenticated(r) {
+			continue
+		}
+		authenticated = true
+
+		if hasScopes(GetGrantedScopes(r), requirement.scopes) {
+			if !sentByBrowser(requirement.provider) {
+				middlewares.ExemptFromCSRF(r)
+			}
+			return nil
+		}
+	}
+
+	if optional {
+		return nil
+	}
+
+	if authenticated {
+		return responses.Forbidden("missing required scopes")
+	}
+
+	err := responses.Unauthorized("")
+	for _, requirement := range requirements {
+		if challenger, ok := requirement.provider.(SecurityChallenger); ok {
+			err.WithHeader("WWW-Authenticate", challenger.GetChallenge(r))
+		}
+	}
+	return err
+}
+
+// sentByBrowser reports whether the browser sends the provider credentials automatically (cookies, Basic, Digest, client certificates),
+// requests authenticated by these providers need CSRF protection. Unknown providers are assumed to be sent by the browser.
+func sentByBrowser(provider SecurityProvider) bool {
+	switch provider.(type) {
+	case *BasicSecurity, *DigestSecurity, *MTLSSecurity:
+		return true
+	}
+
+	schemeProvider, ok := provider.(SecuritySchemeProvider)
+	if !ok {
+		return true
+	}
+
+	return schemeProvider.GetSecurityScheme().In == "cookie"
+}
+
+func hasScopes(granted []string, required []string) bool {
+	grantedSet := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		grantedSet[scope] = true
+	}
+
+	for _, scope := range required {
+		if !grantedSet[scope] {
+			return false
 		}
-	}()
+	}
 
-	return r.GetString(sec.headerName) == sec.apiKey
+	return true
 }
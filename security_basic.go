@@ -0,0 +1,329 @@
+package goapi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hvuhsg/goapi/request"
+)
+
+var usernameKey = request.NewKey[string]("username")
+
+// GetUsername returns the user authenticated by the Basic, Digest or mutual TLS security providers.
+func GetUsername(r *request.Request) (string, bool) {
+	return request.GetValue(r, usernameKey)
+}
+
+// BasicSecurity authenticates requests with HTTP Basic authentication.
+type BasicSecurity struct {
+	name        string
+	realm       string
+	description string
+	store       CredentialStore
+}
+
+// NewBasicSecurity creates Basic security provider named "basic" that checks the credentials against the store.
+func NewBasicSecurity(realm string, store CredentialStore) *BasicSecurity {
+	return &BasicSecurity{name: "basic", realm: realm, store: store}
+}
+
+// Name sets the security scheme name, default to "basic"
+func (sec *BasicSecurity) Name(name string) *BasicSecurity {
+	sec.name = name
+	return sec
+}
+
+// Description sets the security scheme description, shown in the docs
+func (sec *BasicSecurity) Description(description string) *BasicSecurity {
+	sec.description = description
+	return sec
+}
+
+func (sec *BasicSecurity) GetName() string {
+	return sec.name
+}
+
+func (sec *BasicSecurity) GetScopes() []string {
+	return []string{}
+}
+
+func (sec *BasicSecurity) GetSecurityScheme() *openapi3.SecurityScheme {
+	return httpAuthScheme("basic", sec.realm, sec.description)
+}
+
+func (sec *BasicSecurity) GetChallenge(*request.Request) string {
+	return `Basic realm=` + quoteAuthParam(sec.realm) + `, charset="UTF-8"`
+}
+
+func (sec *BasicSecurity) IsAuthenticated(r *request.Request) bool {
+	if r.HTTPRequest == nil {
+		return false
+	}
+
+	username, password, ok := r.HTTPRequest.BasicAuth()
+	if !ok || !sec.store.Authenticate(username, password) {
+		return false
+	}
+
+	request.SetValue(r, usernameKey, username)
+	return true
+}
+
+// DigestSecurity authenticates requests with HTTP Digest authentication (RFC 7616, qop=auth).
+//
+// Nonces are signed and carry their creation time so they don't have to be stored,
+// the nonce counts are tracked to reject replayed requests.
+type DigestSecurity struct {
+	name          string
+	realm         string
+	description   string
+	algorithm     string
+	nonceLifetime time.Duration
+	store         DigestCredentialStore
+	key           []byte
+
+	mu         sync.Mutex
+	nonceCount map[string]uint64
+	lastPrune  time.Time
+}
+
+var staleNonceKey = request.NewKey[bool]("digest-stale-nonce")
+
+// NewDigestSecurity creates Digest security provider named "digest" that checks the credentials against the store.
+func NewDigestSecurity(realm string, store DigestCredentialStore) *DigestSecurity {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	return &DigestSecurity{
+		name:          "digest",
+		realm:         realm,
+		algorithm:     "SHA-256",
+		nonceLifetime: 5 * time.Minute,
+		store:         store,
+		key:           key,
+		nonceCount:    make(map[string]uint64),
+		lastPrune:     time.Now(),
+	}
+}
+
+// Name sets the security scheme name, default to "digest"
+func (sec *DigestSecurity) Name(name string) *DigestSecurity {
+	sec.name = name
+	return sec
+}
+
+// Description sets the security scheme description, shown in the docs
+func (sec *DigestSecurity) Description(description string) *DigestSecurity {
+	sec.description = description
+	return sec
+}
+
+// Algorithm sets the digest algorithm, "SHA-256" (default) or "MD5" for old clients
+func (sec *DigestSecurity) Algorithm(algorithm string) *DigestSecurity {
+	if algorithm != "SHA-256" && algorithm != "MD5" {
+		panic("unsupported digest algorithm " + algorithm)
+	}
+	sec.algorithm = algorithm
+	return sec
+}
+
+// NonceLifetime sets how long the nonces are valid, default to 5 minutes
+func (sec *DigestSecurity) NonceLifetime(lifetime time.Duration) *DigestSecurity {
+	sec.nonceLifetime = lifetime
+	return sec
+}
+
+func (sec *DigestSecurity) GetName() string {
+	return sec.name
+}
+
+func (sec *DigestSecurity) GetScopes() []string {
+	return []string{}
+}
+
+func (sec *DigestSecurity) GetSecurityScheme() *openapi3.SecurityScheme {
+	return httpAuthScheme("digest", sec.realm, sec.description)
+}
+
+func (sec *DigestSecurity) GetChallenge(r *request.Request) string {
+	challenge := `Digest realm=` + quoteAuthParam(sec.realm) +
+		`, qop="auth", algorithm=` + sec.algorithm +
+		`, nonce="` + sec.newNonce(time.Now()) + `"`
+
+	if stale, _ := request.GetValue(r, staleNonceKey); stale {
+		challenge += ", stale=true"
+	}
+
+	return challenge
+}
+
+func (sec *DigestSecurity) IsAuthenticated(r *request.Request) bool {
+	if r.HTTPRequest == nil {
+		return false
+	}
+
+	scheme, credentials, found := strings.Cut(r.HTTPRequest.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Digest") {
+		return false
+	}
+
+	params := parseAuthParams(credentials)
+	username := params["username"]
+	if username == "" || params["realm"] != sec.realm || params["qop"] != "auth" || params["cnonce"] == "" {
+		return false
+	}
+
+	if algorithm := params["algorithm"]; algorithm != "" && algorithm != sec.algorithm {
+		return false
+	}
+
+	if params["uri"] != r.HTTPRequest.RequestURI {
+		return false
+	}
+
+	nc, err := strconv.ParseUint(params["nc"], 16, 64)
+	if err != nil {
+		return false
+	}
+
+	nonce := params["nonce"]
+	created, ok := sec.verifyNonce(nonce)
+	if !ok {
+		return false
+	}
+
+	ha1, ok := sec.store.DigestHA1(username, sec.realm, sec.algorithm)
+	if !ok {
+		return false
+	}
+
+	ha2 := digestHash(sec.algorithm, r.HTTPRequest.Method+":"+params["uri"])
+	expected := digestHash(sec.algorithm, ha1+":"+nonce+":"+params["nc"]+":"+params["cnonce"]+":auth:"+ha2)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(params["response"])) != 1 {
+		return false
+	}
+
+	// Correct credentials with expired nonce, tell the client to retry with new nonce without asking the user
+	if time.Since(created) > sec.nonceLifetime {
+		request.SetValue(r, staleNonceKey, true)
+		return false
+	}
+
+	if !sec.useNonceCount(nonce, nc) {
+		return false
+	}
+
+	request.SetValue(r, usernameKey, username)
+	return true
+}
+
+// newNonce creates nonce from the creation time and random bytes signed with the provider key
+func (sec *DigestSecurity) newNonce(created time.Time) string {
+	data := make([]byte, 16, 48)
+	binary.BigEndian.PutUint64(data, uint64(created.UnixNano()))
+	rand.Read(data[8:])
+
+	mac := hmac.New(sha256.New, sec.key)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(data))
+}
+
+// verifyNonce checks the nonce signature and returns its creation time
+func (sec *DigestSecurity) verifyNonce(nonce string) (time.Time, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(data) != 48 {
+		return time.Time{}, false
+	}
+
+	mac := hmac.New(sha256.New, sec.key)
+	mac.Write(data[:16])
+	if !hmac.Equal(mac.Sum(nil), data[16:]) {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data))), true
+}
+
+// useNonceCount accepts only nonce counts higher than the last used count of the nonce
+func (sec *DigestSecurity) useNonceCount(nonce string, nc uint64) bool {
+	sec.mu.Lock()
+	defer sec.mu.Unlock()
+
+	if time.Since(sec.lastPrune) > sec.nonceLifetime {
+		for n := range sec.nonceCount {
+			if created, _ := sec.verifyNonce(n); time.Since(created) > sec.nonceLifetime {
+				delete(sec.nonceCount, n)
+			}
+		}
+		sec.lastPrune = time.Now()
+	}
+
+	if nc <= sec.nonceCount[nonce] {
+		return false
+	}
+
+	sec.nonceCount[nonce] = nc
+	return true
+}
+
+// httpAuthScheme creates http security scheme, the realm is added as x-realm extension
+func httpAuthScheme(scheme string, realm string, description string) *openapi3.SecurityScheme {
+	securityScheme := openapi3.NewSecurityScheme().WithType("http").WithScheme(scheme).WithDescription(description)
+	securityScheme.Extensions = map[string]interface{}{"x-realm": realm}
+	return securityScheme
+}
+
+func quoteAuthParam(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// parseAuthParams parses comma separated key=value pairs, values may be quoted
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", ") {
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimSpace(rest)
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			if i < len(rest) {
+				i++ // closing quote
+			}
+			s = rest[i:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end == -1 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			s = rest[end:]
+		}
+
+		params[key] = value.String()
+	}
+
+	return params
+}
@@ -0,0 +1,504 @@
+package goapi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hvuhsg/goapi/request"
+	"golang.org/x/sync/singleflight"
+)
+
+// Minimum time between JWKS reloads triggered by unknown key ids
+const jwksMinRefreshInterval = time.Minute
+
+// JWTOptions configures the JWT bearer security provider.
+//
+// At least one key source is required: HMACSecret (HS256), PublicKey (RS256 / ES256),
+// JWKSFile or JWKSURL. Tokens with a key id (kid header) are verified with the matching JWKS key.
+type JWTOptions struct {
+	Name        string // Security scheme name, default to "jwt"
+	Description string // Security scheme description, shown in the docs
+
+	HMACSecret []byte           // Secret for HS256 tokens
+	PublicKey  crypto.PublicKey // *rsa.PublicKey for RS256 or *ecdsa.PublicKey (P-256) for ES256
+
+	JWKSFile            string        // Path to JWKS document
+	JWKSURL             string        // URL of JWKS document (e.g https://issuer/.well-known/jwks.json)
+	JWKSRefreshInterval time.Duration // How often the JWKS is reloaded, default to one hour
+	HTTPClient          *http.Client  // Client used to fetch the JWKS, default to client with 10 seconds timeout
+
+	Issuer   string        // Expected "iss" claim, not checked when empty
+	Audience string        // Expected "aud" claim, not checked when empty
+	Leeway   time.Duration // Allowed clock skew for "exp" and "nbf"
+
+	Scopes []string // Scopes required when the provider is used without explicit scopes
+}
+
+// JWTClaims are the claims of a verified token.
+type JWTClaims map[string]any
+
+// Subject returns the "sub" claim
+func (c JWTClaims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Scopes returns the token scopes from the "scope" (space separated) or "scp" claims
+func (c JWTClaims) Scopes() []string {
+	scopes := make([]string, 0)
+
+	for _, claim := range []string{"scope", "scp"} {
+		switch v := c[claim].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(v)...)
+		case []any:
+			for _, scope := range v {
+				if s, ok := scope.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+		}
+	}
+
+	return scopes
+}
+
+// HasScopes reports whether the token has all the scopes
+func (c JWTClaims) HasScopes(scopes ...string) bool {
+	tokenScopes := make(map[string]bool)
+	for _, scope := range c.Scopes() {
+		tokenScopes[scope] = true
+	}
+
+	for _, scope := range scopes {
+		if !tokenScopes[scope] {
+			return false
+		}
+	}
+
+	return true
+}
+
+var jwtClaimsKey = request.NewKey[JWTClaims]("jwt-claims")
+
+// GetJWTClaims returns the claims of the token that authenticated the request.
+func GetJWTClaims(r *request.Request) (JWTClaims, bool) {
+	return request.GetValue(r, jwtClaimsKey)
+}
+
+// JWTSecurity authenticates requests with JWT bearer tokens (Authorization: Bearer <token>).
+// The claims of valid tokens are available to the middlewares and views using GetJWTClaims.
+type JWTSecurity struct {
+	options JWTOptions
+
+	lock         sync.Mutex     // Guards the jwks fields, not held while the JWKS is fetched
+	jwks         map[string]any // kid -> []byte / *rsa.PublicKey / *ecdsa.PublicKey
+	jwksLoadedAt time.Time
+	jwksTriedAt  time.Time
+	jwksReload   singleflight.Group
+}
+
+// NewJWTSecurity creates JWT security provider, the JWKS (if configured) is loaded immediately.
+func NewJWTSecurity(options JWTOptions) (*JWTSecurity, error) {
+	if options.Name == "" {
+		options.Name = "jwt"
+	}
+
+	if options.JWKSRefreshInterval == 0 {
+		options.JWKSRefreshInterval = time.Hour
+	}
+
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if options.HMACSecret == nil && options.PublicKey == nil && options.JWKSFile == "" && options.JWKSURL == "" {
+		return nil, errors.New("jwt security requires HMACSecret, PublicKey, JWKSFile or JWKSURL")
+	}
+
+	switch key := options.PublicKey.(type) {
+	case nil, *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("jwt security supports only P-256 ecdsa keys (ES256)")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", options.PublicKey)
+	}
+
+	sec := &JWTSecurity{options: options}
+
+	if options.JWKSFile != "" || options.JWKSURL != "" {
+		if err := sec.loadJWKS(); err != nil {
+			return nil, err
+		}
+	}
+
+	return sec, nil
+}
+
+func (sec *JWTSecurity) GetName() string {
+	return sec.options.Name
+}
+
+func (sec *JWTSecurity) GetScopes() []string {
+	return sec.options.Scopes
+}
+
+func (sec *JWTSecurity) GetSecurityScheme() *openapi3.SecurityScheme {
+	return openapi3.NewJWTSecurityScheme().WithDescription(sec.options.Description)
+}
+
+func (sec *JWTSecurity) GetChallenge(*request.Request) string {
+	return `Bearer realm="` + sec.options.Name + `"`
+}
+
+func (sec *JWTSecurity) IsAuthenticated(r *request.Request) bool {
+	token, ok := bearerToken(r)
+	if !ok {
+		return false
+	}
+
+	claims, err := sec.Verify(token)
+	if err != nil {
+		return false
+	}
+
+	request.SetValue(r, jwtClaimsKey, claims)
+	SetGrantedScopes(r, claims.Scopes())
+	return true
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the token signature and the registered claims (exp, nbf, iss, aud) and returns the token claims.
+func (sec *JWTSecurity) Verify(token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	key, err := sec.key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims JWTClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	if err := sec.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (sec *JWTSecurity) validateClaims(claims JWTClaims) error {
+	now := time.Now()
+
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(sec.options.Leeway)) {
+			return errors.New("token is expired")
+		}
+	} else if _, found := claims["exp"]; found {
+		return errors.New("invalid exp claim")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(sec.options.Leeway).Before(time.Unix(int64(nbf), 0)) {
+			return errors.New("token is not valid yet")
+		}
+	} else if _, found := claims["nbf"]; found {
+		return errors.New("invalid nbf claim")
+	}
+
+	if sec.options.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != sec.options.Issuer {
+			return errors.New("invalid token issuer")
+		}
+	}
+
+	if sec.options.Audience != "" {
+		valid := false
+		switch aud := claims["aud"].(type) {
+		case string:
+			valid = aud == sec.options.Audience
+		case []any:
+			for _, a := range aud {
+				if a == sec.options.Audience {
+					valid = true
+				}
+			}
+		}
+
+		if !valid {
+			return errors.New("invalid token audience")
+		}
+	}
+
+	return nil
+}
+
+// key finds the verification key for the token, the key type must match the algorithm
+func (sec *JWTSecurity) key(kid string, alg string) (any, error) {
+	hasJWKS := sec.options.JWKSFile != "" || sec.options.JWKSURL != ""
+	if hasJWKS {
+		if sec.jwksNeedsReload(kid) {
+			sec.reloadJWKS()
+		}
+
+		sec.lock.Lock()
+		key, ok := sec.jwks[kid]
+		sec.lock.Unlock()
+
+		if ok && jwtKeyMatchesAlg(key, alg) {
+			return key, nil
+		}
+	}
+
+	if kid == "" || !hasJWKS {
+		switch alg {
+		case "HS256":
+			if sec.options.HMACSecret != nil {
+				return sec.options.HMACSecret, nil
+			}
+		case "RS256", "ES256":
+			if sec.options.PublicKey != nil && jwtKeyMatchesAlg(sec.options.PublicKey, alg) {
+				return sec.options.PublicKey, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no key for kid '%s' and alg '%s'", kid, alg)
+}
+
+// jwksNeedsReload reports whether the JWKS expired or misses the kid, reloads are rate limited
+func (sec *JWTSecurity) jwksNeedsReload(kid string) bool {
+	sec.lock.Lock()
+	defer sec.lock.Unlock()
+
+	_, known := sec.jwks[kid]
+	expired := time.Since(sec.jwksLoadedAt) > sec.options.JWKSRefreshInterval
+	return (expired || (kid != "" && !known)) && time.Since(sec.jwksTriedAt) > jwksMinRefreshInterval
+}
+
+// reloadJWKS reloads the JWKS, concurrent requests wait for the same reload
+func (sec *JWTSecurity) reloadJWKS() {
+	sec.jwksReload.Do("jwks", func() (any, error) {
+		sec.lock.Lock()
+		reloaded := time.Since(sec.jwksTriedAt) <= jwksMinRefreshInterval
+		sec.lock.Unlock()
+
+		// Reloaded by a call that finished after jwksNeedsReload
+		if reloaded {
+			return nil, nil
+		}
+		return nil, sec.loadJWKS()
+	})
+}
+
+// loadJWKS loads the keys from file or url and swaps them in, the lock is held only for the swap
+func (sec *JWTSecurity) loadJWKS() error {
+	sec.lock.Lock()
+	sec.jwksTriedAt = time.Now()
+	sec.lock.Unlock()
+
+	var data []byte
+	var err error
+	if sec.options.JWKSFile != "" {
+		data, err = os.ReadFile(sec.options.JWKSFile)
+	} else {
+		data, err = fetchJWKS(sec.options.HTTPClient, sec.options.JWKSURL)
+	}
+
+	if err == nil {
+		var keys map[string]any
+		keys, err = parseJWKS(data)
+		if err == nil {
+			sec.lock.Lock()
+			sec.jwks = keys
+			sec.jwksLoadedAt = time.Now()
+			sec.lock.Unlock()
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("can't load jwks: %w", err)
+	}
+
+	return nil
+}
+
+func fetchJWKS(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS parse JWKS document (RFC 7517) into kid -> key map, unsupported keys are skipped
+func parseJWKS(data []byte) (map[string]any, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key '%s': %w", jwk.Kid, err)
+		}
+
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "oct":
+		return decode(jwk.K)
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func jwtKeyMatchesAlg(key any, alg string) bool {
+	switch k := key.(type) {
+	case []byte:
+		return alg == "HS256"
+	case *rsa.PublicKey:
+		return alg == "RS256"
+	case *ecdsa.PublicKey:
+		return alg == "ES256" && k.Curve == elliptic.P256()
+	default:
+		return false
+	}
+}
+
+func verifyJWTSignature(alg string, key any, signingInput []byte, signature []byte) error {
+	hash := sha256.Sum256(signingInput)
+
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid token signature")
+		}
+	case "RS256":
+		if err := rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, hash[:], signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+	case "ES256":
+		if len(signature) != 64 {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key.(*ecdsa.PublicKey), hash[:], r, s) {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+
+	return nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
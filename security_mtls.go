@@ -0,0 +1,65 @@
+package goapi
+
+import (
+	"crypto/x509"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hvuhsg/goapi/request"
+)
+
+// MTLSSecurity authenticates requests with the verified client certificate of mutual TLS connections,
+// run the app with RunTLSWithOptions and ClientCAFile set.
+//
+// The certificate common name is available with GetUsername.
+//
+// The mutualTLS security scheme exists since OpenAPI 3.1, in 3.0 schemas the scheme
+// and the requirements using it are left out.
+type MTLSSecurity struct {
+	name        string
+	description string
+	authorize   func(cert *x509.Certificate) bool
+}
+
+// NewMTLSSecurity creates mutual TLS security provider named "mtls",
+// authorize decides which verified certificates are accepted, nil accepts all of them.
+func NewMTLSSecurity(authorize func(cert *x509.Certificate) bool) *MTLSSecurity {
+	return &MTLSSecurity{name: "mtls", authorize: authorize}
+}
+
+// Name sets the security provider name, default to "mtls"
+func (sec *MTLSSecurity) Name(name string) *MTLSSecurity {
+	sec.name = name
+	return sec
+}
+
+// Description sets the security scheme description, shown in the docs
+func (sec *MTLSSecurity) Description(description string) *MTLSSecurity {
+	sec.description = description
+	return sec
+}
+
+func (sec *MTLSSecurity) GetName() string {
+	return sec.name
+}
+
+func (sec *MTLSSecurity) GetScopes() []string {
+	return []string{}
+}
+
+func (sec *MTLSSecurity) GetSecurityScheme() *openapi3.SecurityScheme {
+	return openapi3.NewSecurityScheme().WithType(mutualTLSSchemeType).WithDescription(sec.description)
+}
+
+func (sec *MTLSSecurity) IsAuthenticated(r *request.Request) bool {
+	cert := r.ClientCertificate()
+	if cert == nil {
+		return false
+	}
+
+	if sec.authorize != nil && !sec.authorize(cert) {
+		return false
+	}
+
+	request.SetValue(r, usernameKey, cert.Subject.CommonName)
+	return true
+}
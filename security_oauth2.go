@@ -0,0 +1,116 @@
+package goapi
+
+import (
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hvuhsg/goapi/request"
+)
+
+// TokenValidator validates bearer access token and returns the scopes granted to it.
+type TokenValidator func(r *request.Request, token string) (scopes []string, err error)
+
+// OAuth2Options configures the OAuth2 / OpenID Connect security provider.
+type OAuth2Options struct {
+	Name        string // Security scheme name, default to "oauth2"
+	Description string // Security scheme description, shown in the docs
+
+	// OAuth2 flows shown in the docs, the Authorize button of the docs uses them to get tokens.
+	Flows *openapi3.OAuthFlows
+
+	// OpenID Connect discovery URL (https://issuer/.well-known/openid-configuration),
+	// when set the scheme is documented as openIdConnect instead of oauth2.
+	OpenIDConnectURL string
+
+	// Validates the access tokens, required.
+	// Use JWTTokenValidator for JWT access tokens or call the token introspection endpoint of the authorization server.
+	ValidateToken TokenValidator
+}
+
+// OAuth2Security authenticates requests with OAuth2 bearer access tokens,
+// the scopes of the token are checked against the scopes required by the app and the views.
+type OAuth2Security struct {
+	options OAuth2Options
+}
+
+func NewOAuth2Security(options OAuth2Options) *OAuth2Security {
+	if options.ValidateToken == nil {
+		panic("oauth2 security requires ValidateToken")
+	}
+
+	if options.Name == "" {
+		options.Name = "oauth2"
+	}
+
+	if options.Flows == nil {
+		options.Flows = &openapi3.OAuthFlows{}
+	}
+
+	return &OAuth2Security{options: options}
+}
+
+func (sec *OAuth2Security) GetName() string {
+	return sec.options.Name
+}
+
+func (sec *OAuth2Security) GetScopes() []string {
+	return []string{}
+}
+
+func (sec *OAuth2Security) GetSecurityScheme() *openapi3.SecurityScheme {
+	if sec.options.OpenIDConnectURL != "" {
+		return openapi3.NewOIDCSecurityScheme(sec.options.OpenIDConnectURL).WithDescription(sec.options.Description)
+	}
+
+	scheme := openapi3.NewSecurityScheme().WithType("oauth2").WithDescription(sec.options.Description)
+	scheme.Flows = sec.options.Flows
+	return scheme
+}
+
+func (sec *OAuth2Security) GetChallenge(*request.Request) string {
+	return `Bearer realm="` + sec.options.Name + `"`
+}
+
+func (sec *OAuth2Security) IsAuthenticated(r *request.Request) bool {
+	token, ok := bearerToken(r)
+	if !ok {
+		return false
+	}
+
+	scopes, err := sec.options.ValidateToken(r, token)
+	if err != nil {
+		return false
+	}
+
+	SetGrantedScopes(r, scopes)
+	return true
+}
+
+// JWTTokenValidator validates JWT access tokens with the JWT provider,
+// the token claims are available to the views using GetJWTClaims.
+func JWTTokenValidator(jwt *JWTSecurity) TokenValidator {
+	return func(r *request.Request, token string) ([]string, error) {
+		claims, err := jwt.Verify(token)
+		if err != nil {
+			return nil, err
+		}
+
+		request.SetValue(r, jwtClaimsKey, claims)
+		return claims.Scopes(), nil
+	}
+}
+
+// bearerToken extracts the token from the Authorization header
+func bearerToken(r *request.Request) (string, bool) {
+	if r.HTTPRequest == nil {
+		return "", false
+	}
+
+	scheme, token, found := strings.Cut(r.HTTPRequest.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
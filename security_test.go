@@ -0,0 +1,673 @@
+package goapi_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hvuhsg/goapi"
+	"github.com/hvuhsg/goapi/middlewares"
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signJWT creates signed token for tests
+func signJWT(t *testing.T, alg string, kid string, key any, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := b64(header) + "." + b64(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + b64(signature)
+}
+
+func TestJWTVerify(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// JWKS with the ecdsa key
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "kid": "ec-1", "crv": "P-256", "use": "sig",
+		"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+	}, {
+		"kty": "RSA", "kid": "rsa-1",
+		"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(jwksPath, jwks, 0644)
+
+	sec, err := goapi.NewJWTSecurity(goapi.JWTOptions{
+		HMACSecret: secret,
+		JWKSFile:   jwksPath,
+		Issuer:     "https://issuer",
+		Audience:   "api",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	now := time.Now().Unix()
+	valid := map[string]any{"sub": "user", "iss": "https://issuer", "aud": []string{"other", "api"}, "exp": now + 60}
+
+	cases := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"HS256", signJWT(t, "HS256", "", secret, valid), true},
+		{"RS256 from jwks", signJWT(t, "RS256", "rsa-1", rsaKey, valid), true},
+		{"ES256 from jwks", signJWT(t, "ES256", "ec-1", ecKey, valid), true},
+		{"wrong secret", signJWT(t, "HS256", "", []byte("other"), valid), false},
+		{"unknown kid", signJWT(t, "ES256", "ec-2", ecKey, valid), false},
+		{"alg mismatch", signJWT(t, "HS256", "rsa-1", secret, valid), false},
+		{"expired", signJWT(t, "HS256", "", secret, map[string]any{"iss": "https://issuer", "aud": "api", "exp": now - 60}), false},
+		{"not before", signJWT(t, "HS256", "", secret, map[string]any{"iss": "https://issuer", "aud": "api", "nbf": now + 60}), false},
+		{"wrong issuer", signJWT(t, "HS256", "", secret, map[string]any{"iss": "https://other", "aud": "api"}), false},
+		{"wrong audience", signJWT(t, "HS256", "", secret, map[string]any{"iss": "https://issuer", "aud": "web"}), false},
+		{"malformed", "a.b", false},
+	}
+
+	for _, c := range cases {
+		claims, err := sec.Verify(c.token)
+		if c.valid && (err != nil || claims.Subject() != "user") {
+			t.Errorf("%s: expecting valid token got error %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: expecting invalid token", c.name)
+		}
+	}
+}
+
+func TestJWTSecurity(t *testing.T) {
+	secret := []byte("secret")
+	sec, err := goapi.NewJWTSecurity(goapi.JWTOptions{HMACSecret: secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	app := goapi.GoAPI("jwt", "1.0")
+	app.Security(sec)
+
+	me := app.Path("/me")
+	me.Methods(goapi.GET)
+	me.Description("current user")
+	me.Action(func(request *request.Request) responses.Response {
+		claims, _ := goapi.GetJWTClaims(request)
+		return responses.NewJSONResponse(responses.Json{"sub": claims.Subject()}, 200)
+	})
+
+	admin := app.Path("/admin")
+	admin.Methods(goapi.GET)
+	admin.Description("admin only")
+	admin.Security(sec, "admin")
+	admin.Action(func(request *request.Request) responses.Response {
+		return responses.NewHTMLResponse("admin", 200)
+	})
+
+	go app.Run("127.0.0.1", 8084)
+
+	time.Sleep(time.Millisecond * 200)
+
+	userToken := signJWT(t, "HS256", "", secret, map[string]any{"sub": "yoyo", "scope": "read write"})
+	adminToken := signJWT(t, "HS256", "", secret, map[string]any{"sub": "root", "scp": []string{"admin"}})
+
+	cases := []struct {
+		path         string
+		token        string
+		expectedCode int
+	}{
+		{"/me", "", 401},
+		{"/me", "invalid", 401},
+		{"/me", userToken, 200},
+		{"/admin", userToken, 403},
+		{"/admin", adminToken, 200},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8084"+c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		if resp.StatusCode != c.expectedCode {
+			t.Errorf("%s: expecting status-code %d got %d", c.path, c.expectedCode, resp.StatusCode)
+		}
+
+		if resp.StatusCode == 401 && resp.Header.Get("WWW-Authenticate") != `Bearer realm="jwt"` {
+			t.Errorf("expecting bearer challenge got '%s'", resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+
+	resp, err := http.Get("http://127.0.0.1:8084/openapi.json")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	schema, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(schema), `"securitySchemes":{"jwt":{"bearerFormat":"JWT","scheme":"bearer","type":"http"}}`) {
+		t.Errorf("expecting jwt security scheme in the schema got %s", schema)
+	}
+}
+
+func TestViewSecurity(t *testing.T) {
+	secret := []byte("secret")
+	jwt, _ := goapi.NewJWTSecurity(goapi.JWTOptions{HMACSecret: secret})
+	oauth2 := goapi.NewOAuth2Security(goapi.OAuth2Options{
+		Flows: &openapi3.OAuthFlows{ClientCredentials: &openapi3.OAuthFlow{
+			TokenURL: "https://issuer/token",
+			Scopes:   map[string]string{"users:write": "modify users"},
+		}},
+		ValidateToken: goapi.JWTTokenValidator(jwt),
+	})
+
+	app := goapi.GoAPI("view security", "1.0")
+	app.Security(goapi.NewAPIKeySecurity("api-key", goapi.QUERY, "key", "old-key", "new-key"))
+
+	users := app.Path("/users")
+	users.Methods(goapi.GET, goapi.POST)
+	users.Description("users")
+	users.Security(oauth2, "users:write")
+	users.Action(func(request *request.Request) responses.Response {
+		return responses.NewJSONResponse(responses.Json{"scopes": goapi.GetGrantedScopes(request)}, 200)
+	})
+
+	health := app.Path("/health")
+	health.Methods(goapi.GET)
+	health.Description("health check")
+	health.OptionalSecurity()
+	health.Action(func(request *request.Request) responses.Response {
+		return responses.NewHTMLResponse("ok", 200)
+	})
+
+	items := app.Path("/items")
+	items.Methods(goapi.GET)
+	items.Description("items")
+	items.Action(func(request *request.Request) responses.Response {
+		return responses.NewHTMLResponse("items", 200)
+	})
+
+	go app.Run("127.0.0.1", 8085)
+
+	time.Sleep(time.Millisecond * 200)
+
+	readToken := signJWT(t, "HS256", "", secret, map[string]any{"scope": "users:read"})
+	writeToken := signJWT(t, "HS256", "", secret, map[string]any{"scope": "users:read users:write"})
+
+	cases := []struct {
+		url          string
+		token        string
+		expectedCode int
+	}{
+		{"/items", "", 401},
+		{"/items?key=new-key", "", 200},
+		{"/items?key=wrong", "", 401},
+		{"/health", "", 200},
+		{"/users?key=new-key", "", 401},
+		{"/users", readToken, 403},
+		{"/users", writeToken, 200},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8085"+c.url, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		if resp.StatusCode != c.expectedCode {
+			t.Errorf("%s: expecting status-code %d got %d", c.url, c.expectedCode, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get("http://127.0.0.1:8085/openapi.json")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	var schema struct {
+		Components struct {
+			SecuritySchemes map[string]map[string]any `json:"securitySchemes"`
+		} `json:"components"`
+		Security []map[string][]string                            `json:"security"`
+		Paths    map[string]map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	json.NewDecoder(resp.Body).Decode(&schema)
+
+	if schema.Components.SecuritySchemes["api-key"]["in"] != "query" || schema.Components.SecuritySchemes["oauth2"]["type"] != "oauth2" {
+		t.Errorf("expecting api-key and oauth2 security schemes got %v", schema.Components.SecuritySchemes)
+	}
+
+	if len(schema.Security) != 1 || schema.Security[0]["api-key"] == nil {
+		t.Errorf("expecting app security requirement got %v", schema.Security)
+	}
+
+	if string(schema.Paths["/users"]["post"]["security"]) != `[{"oauth2":["users:write"]}]` {
+		t.Errorf("expecting view security requirement got %s", schema.Paths["/users"]["post"]["security"])
+	}
+
+	if string(schema.Paths["/health"]["get"]["security"]) != `[{}]` {
+		t.Errorf("expecting optional view security got %s", schema.Paths["/health"]["get"]["security"])
+	}
+}
+
+func TestMemoryCredentialStore(t *testing.T) {
+	store := goapi.NewMemoryCredentialStore(map[string]string{"admin": "secret"})
+
+	if !store.Authenticate("admin", "secret") {
+		t.Errorf("expecting known user to authenticate")
+	}
+	if store.Authenticate("admin", "wrong") {
+		t.Errorf("expecting wrong password to fail")
+	}
+	if store.Authenticate("nobody", "secret") || store.Authenticate("nobody", "unknown user") {
+		t.Errorf("expecting unknown user to fail")
+	}
+}
+
+func TestBasicSecurity(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, ".htpasswd")
+	os.WriteFile(htpasswd, []byte("# users\nadmin:"+string(hash)+"\n"), 0644)
+
+	store, err := goapi.NewHtpasswdCredentialStore(htpasswd)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "plain"), []byte("admin:secret\n"), 0644)
+	if _, err := goapi.NewHtpasswdCredentialStore(filepath.Join(dir, "plain")); err == nil {
+		t.Errorf("expecting error for non bcrypt htpasswd")
+	}
+
+	app := goapi.GoAPI("basic", "1.0")
+	app.Security(goapi.NewBasicSecurity("internal tools", store))
+
+	me := app.Path("/me")
+	me.Methods(goapi.GET)
+	me.Description("current user")
+	me.Action(func(request *request.Request) responses.Response {
+		username, _ := goapi.GetUsername(request)
+		return responses.NewHTMLResponse(username, 200)
+	})
+
+	go app.Run("127.0.0.1", 8086)
+
+	time.Sleep(time.Millisecond * 200)
+
+	cases := []struct {
+		username     string
+		password     string
+		expectedCode int
+	}{
+		{"", "", 401},
+		{"admin", "wrong", 401},
+		{"other", "secret", 401},
+		{"admin", "secret", 200},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8086/me", nil)
+		if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		if resp.StatusCode != c.expectedCode {
+			t.Errorf("%s: expecting status-code %d got %d", c.username, c.expectedCode, resp.StatusCode)
+		}
+
+		if resp.StatusCode == 401 && resp.Header.Get("WWW-Authenticate") != `Basic realm="internal tools", charset="UTF-8"` {
+			t.Errorf("expecting basic challenge got '%s'", resp.Header.Get("WWW-Authenticate"))
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == 200 && string(body) != "admin" {
+			t.Errorf("expecting username admin got %s", body)
+		}
+	}
+
+	resp, err := http.Get("http://127.0.0.1:8086/openapi.json")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	schema, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(schema), `"securitySchemes":{"basic":{"scheme":"basic","type":"http","x-realm":"internal tools"}}`) {
+		t.Errorf("expecting basic security scheme in the schema got %s", schema)
+	}
+}
+
+// digestAuthorization answers digest challenge like a client
+func digestAuthorization(challenge string, username string, password string, method string, uri string, nc int) string {
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Digest "), ", ") {
+		key, value, _ := strings.Cut(part, "=")
+		params[key] = strings.Trim(value, `"`)
+	}
+
+	h := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	ncValue := fmt.Sprintf("%08x", nc)
+	ha1 := h(username + ":" + params["realm"] + ":" + password)
+	ha2 := h(method + ":" + uri)
+	response := h(ha1 + ":" + params["nonce"] + ":" + ncValue + ":cnonce:auth:" + ha2)
+
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=SHA-256, qop=auth, nc=%s, cnonce="cnonce", response="%s"`,
+		username, params["realm"], params["nonce"], uri, ncValue, response)
+}
+
+func TestDigestSecurity(t *testing.T) {
+	store := goapi.NewMemoryCredentialStore(map[string]string{"admin": "secret"})
+	digest := goapi.NewDigestSecurity("internal tools", store)
+
+	app := goapi.GoAPI("digest", "1.0")
+	app.Security(digest)
+
+	me := app.Path("/me")
+	me.Methods(goapi.GET)
+	me.Description("current user")
+	me.Action(func(request *request.Request) responses.Response {
+		username, _ := goapi.GetUsername(request)
+		return responses.NewHTMLResponse(username, 200)
+	})
+
+	go app.Run("127.0.0.1", 8087)
+
+	time.Sleep(time.Millisecond * 200)
+
+	get := func(authorization string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8087/me?q=1", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+		return resp
+	}
+
+	resp := get("")
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if resp.StatusCode != 401 || !strings.HasPrefix(challenge, `Digest realm="internal tools", qop="auth", algorithm=SHA-256, nonce="`) {
+		t.Fatalf("expecting digest challenge got %d '%s'", resp.StatusCode, challenge)
+	}
+
+	if resp := get(digestAuthorization(challenge, "admin", "wrong", "GET", "/me?q=1", 1)); resp.StatusCode != 401 {
+		t.Errorf("expecting status-code 401 for wrong password got %d", resp.StatusCode)
+	}
+
+	if resp := get(digestAuthorization(challenge, "admin", "secret", "GET", "/other", 1)); resp.StatusCode != 401 {
+		t.Errorf("expecting status-code 401 for wrong uri got %d", resp.StatusCode)
+	}
+
+	authorization := digestAuthorization(challenge, "admin", "secret", "GET", "/me?q=1", 1)
+	resp = get(authorization)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "admin" {
+		t.Errorf("expecting status-code 200 for user admin got %d %s", resp.StatusCode, body)
+	}
+
+	if resp := get(authorization); resp.StatusCode != 401 {
+		t.Errorf("expecting status-code 401 for replayed nonce count got %d", resp.StatusCode)
+	}
+
+	if resp := get(digestAuthorization(challenge, "admin", "secret", "GET", "/me?q=1", 2)); resp.StatusCode != 200 {
+		t.Errorf("expecting status-code 200 for next nonce count got %d", resp.StatusCode)
+	}
+
+	digest.NonceLifetime(0)
+	resp = get(digestAuthorization(challenge, "admin", "secret", "GET", "/me?q=1", 3))
+	if resp.StatusCode != 401 || !strings.HasSuffix(resp.Header.Get("WWW-Authenticate"), ", stale=true") {
+		t.Errorf("expecting stale nonce challenge got %d '%s'", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+}
+
+func TestCSRFExemption(t *testing.T) {
+	secret := []byte("secret")
+	jwt, _ := goapi.NewJWTSecurity(goapi.JWTOptions{HMACSecret: secret})
+	basic := goapi.NewBasicSecurity("app", goapi.NewMemoryCredentialStore(map[string]string{"admin": "secret"}))
+
+	app := goapi.GoAPI("csrf", "1.0")
+	app.Security(jwt)
+	app.Security(basic)
+	app.Middlewares(middlewares.NewCSRFMiddleware(middlewares.CSRFOptions{}))
+
+	items := app.Path("/items")
+	items.Methods(goapi.POST)
+	items.Description("create item")
+	items.Action(func(request *request.Request) responses.Response {
+		return responses.NewHTMLResponse("created", 201)
+	})
+
+	go app.Run("127.0.0.1", 8088)
+
+	time.Sleep(time.Millisecond * 200)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1:8088/items", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, "HS256", "", secret, map[string]any{"sub": "yoyo"}))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if resp.StatusCode != 201 {
+		t.Errorf("expecting bearer request to be exempt from csrf got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1:8088/items", nil)
+	req.SetBasicAuth("admin", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if resp.StatusCode != 403 {
+		t.Errorf("expecting basic auth request to require csrf token got %d", resp.StatusCode)
+	}
+
+	// Browsers send client certificates automatically
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, ca.pem, 0644)
+	serverCert, serverKey := ca.issue(t, dir, "localhost", x509.ExtKeyUsageServerAuth, "localhost")
+	clientCert, clientKey := ca.issue(t, dir, "browser", x509.ExtKeyUsageClientAuth)
+
+	mtlsApp := goapi.GoAPI("csrf mtls", "1.0")
+	mtlsApp.Security(goapi.NewMTLSSecurity(nil))
+	mtlsApp.Middlewares(middlewares.NewCSRFMiddleware(middlewares.CSRFOptions{}))
+
+	mtlsItems := mtlsApp.Path("/items")
+	mtlsItems.Methods(goapi.POST)
+	mtlsItems.Description("create item")
+	mtlsItems.Action(func(request *request.Request) responses.Response {
+		return responses.NewHTMLResponse("created", 201)
+	})
+
+	go mtlsApp.RunTLSWithOptions("127.0.0.1", 8446, goapi.TLSOptions{
+		Certificates: []goapi.CertificateFiles{{CertFile: serverCert, KeyFile: serverKey}},
+		ClientCAFile: caFile,
+	})
+
+	time.Sleep(time.Millisecond * 200)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientKeyPair, _ := tls.LoadX509KeyPair(clientCert, clientKey)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		ServerName:   "localhost",
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientKeyPair},
+	}}}
+
+	resp, err = client.Post("https://127.0.0.1:8446/items", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if resp.StatusCode != 403 {
+		t.Errorf("expecting mtls request to require csrf token got %d", resp.StatusCode)
+	}
+}
+
+func TestSecurityRunsAfterMiddlewares(t *testing.T) {
+	basic := goapi.NewBasicSecurity("app", goapi.NewMemoryCredentialStore(map[string]string{"admin": "secret"}))
+	ipFilter, _ := middlewares.NewIPFilterMiddleware(nil, []string{"127.0.0.1"})
+
+	app := goapi.GoAPI("order", "1.0")
+	app.Security(basic)
+	app.Middlewares(middlewares.NewCORSMiddleware([]string{"https://app.example.com"}, []string{"GET"}, nil))
+
+	for _, path := range []string{"/items", "/blocked"} {
+		view := app.Path(path)
+		view.Methods(goapi.GET)
+		view.Description("list items")
+		view.Action(func(request *request.Request) responses.Response {
+			return responses.NewHTMLResponse("items", 200)
+		})
+		if path == "/blocked" {
+			view.Middlewares(ipFilter)
+		}
+	}
+
+	go app.Run("127.0.0.1", 8100)
+
+	time.Sleep(time.Millisecond * 200)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8100/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if resp.StatusCode != 401 || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("expecting 401 with cors headers got %d '%s'", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+
+	resp, err = http.Get("http://127.0.0.1:8100/blocked")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if resp.StatusCode != 403 || resp.Header.Get("WWW-Authenticate") != "" {
+		t.Errorf("expecting ip filter to reject before authentication got %d", resp.StatusCode)
+	}
+}
+
+func TestSecurityResponsesNotCached(t *testing.T) {
+	app := goapi.GoAPI("cache", "1.0")
+	app.Security(goapi.NewAPISecurity("X-API-Key", "secret"))
+	app.Middlewares(middlewares.NewCacheMiddleware(time.Minute, ""))
+
+	for _, path := range []string{"/secret", "/shared"} {
+		view := app.Path(path)
+		view.Methods(goapi.GET)
+		view.Description("secret data")
+		view.Action(func(request *request.Request) responses.Response {
+			response := responses.NewHTMLResponse("top secret", 200)
+			if request.HTTPRequest.URL.Path == "/shared" {
+				response.Headers().Set("Cache-Control", "public, max-age=60")
+			}
+			return response
+		})
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	go app.Serve(listener)
+
+	time.Sleep(time.Millisecond * 200)
+
+	get := func(path string, key string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("/secret", "secret")
+	if resp.StatusCode != 200 || resp.Header.Get("Cache-Control") != "private" {
+		t.Errorf("expecting private 200 response got %d '%s'", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+
+	if resp := get("/secret", ""); resp.StatusCode != 401 {
+		t.Errorf("expecting anonymous request to be rejected got %d", resp.StatusCode)
+	}
+
+	// Views that explicitly share their responses are cached
+	get("/shared", "secret")
+	if resp := get("/shared", ""); resp.StatusCode != 200 || resp.Header.Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("expecting shared response from cache got %d '%s'", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+}
@@ -0,0 +1,761 @@
+package goapi_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/goapi"
+	"github.com/hvuhsg/goapi/middlewares"
+	"github.com/hvuhsg/goapi/request"
+	"github.com/hvuhsg/goapi/responses"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+)
+
+// memoryCertCache is autocert.Cache that keeps the certificates in memory
+type memoryCertCache struct {
+	lock sync.Mutex
+	data map[string][]byte
+}
+
+func (c *memoryCertCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, ok := c.data[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *memoryCertCache) Put(_ context.Context, key string, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.data[key] = data
+	return nil
+}
+
+func (c *memoryCertCache) Delete(_ context.Context, key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+// selfSignedCert creates certificate for the dns names, returns the cert and key PEM
+func selfSignedCert(t *testing.T, dnsNames ...string) ([]byte, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func newHelloApp(title string) *goapi.App {
+	app := goapi.GoAPI(title, "1.0")
+
+	hello := app.Path("/hello")
+	hello.Methods(goapi.GET, goapi.POST)
+	hello.Description("hello")
+	hello.Action(func(request *request.Request) responses.Response {
+		return responses.NewHTMLResponse("hello "+request.HTTPRequest.Proto, 200)
+	})
+
+	return app
+}
+
+func TestRunAutoTLS(t *testing.T) {
+	// Certificate from the cache, no ACME server is contacted
+	certPEM, keyPEM := selfSignedCert(t, "example.com")
+	cache := &memoryCertCache{data: map[string][]byte{"example.com": append(keyPEM, certPEM...)}}
+
+	app := newHelloApp("auto tls")
+	go app.RunAutoTLS("127.0.0.1", 8443, goapi.AutoTLSOptions{
+		Domains:      []string{"example.com"},
+		Cache:        cache,
+		DirectoryURL: "http://127.0.0.1:1/directory",
+		RedirectAddr: "127.0.0.1:8089",
+	})
+
+	time.Sleep(time.Millisecond * 200)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{ServerName: "example.com", InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	redirects := []struct {
+		method       string
+		expectedCode int
+	}{
+		{http.MethodGet, http.StatusMovedPermanently},
+		{http.MethodPost, http.StatusPermanentRedirect},
+	}
+
+	for _, c := range redirects {
+		req, _ := http.NewRequest(c.method, "http://127.0.0.1:8089/hello?name=yoyo", nil)
+		req.Host = "example.com"
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		if resp.StatusCode != c.expectedCode || resp.Header.Get("Location") != "https://example.com:8443/hello?name=yoyo" {
+			t.Errorf("%s: expecting redirect to https got %d '%s'", c.method, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8089/hello", nil)
+	req.Host = "evil.com"
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Location") != "" {
+		t.Errorf("expecting status-code 400 for unknown host got %d '%s'", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1:8089/.well-known/acme-challenge/token", nil)
+	req.Host = "example.com"
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expecting unknown challenge token to be answered by the acme handler got %d", resp.StatusCode)
+	}
+
+	resp, err = client.Get("https://127.0.0.1:8443/hello")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "hello HTTP/2.0" {
+		t.Errorf("expecting response over https got %d %s", resp.StatusCode, body)
+	}
+
+	if resp.TLS.PeerCertificates[0].Subject.CommonName != "example.com" {
+		t.Errorf("expecting certificate from the cache got %s", resp.TLS.PeerCertificates[0].Subject)
+	}
+}
+
+// acmeStub is a minimal RFC 8555 server, it validates the http-01 challenge on challengeAddr
+// and issues the certificates with the test CA. Signatures are not verified.
+type acmeStub struct {
+	ca            *testCA
+	challengeAddr string
+	server        *httptest.Server
+
+	lock       sync.Mutex
+	accountKey *ecdsa.PublicKey
+	domain     string
+	token      string
+	validated  bool
+	cert       []byte
+}
+
+func newACMEStub(t *testing.T, ca *testCA, challengeAddr string) *acmeStub {
+	stub := &acmeStub{ca: ca, challengeAddr: challengeAddr, token: "token-" + strconv.FormatInt(time.Now().UnixNano(), 36)}
+	stub.server = httptest.NewServer(http.HandlerFunc(stub.serveHTTP))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (stub *acmeStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	url := stub.server.URL
+	w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+
+	if r.URL.Path == "/directory" {
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   url + "/nonce",
+			"newAccount": url + "/account",
+			"newOrder":   url + "/order",
+			"revokeCert": url + "/revoke",
+			"keyChange":  url + "/key-change",
+		})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		return
+	}
+
+	// Requests other than the directory and nonce are JWS
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	json.NewDecoder(r.Body).Decode(&jws)
+	protected, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+
+	switch r.URL.Path {
+	case "/account":
+		var header struct {
+			JWK struct{ X, Y string } `json:"jwk"`
+		}
+		json.Unmarshal(protected, &header)
+		x, _ := base64.RawURLEncoding.DecodeString(header.JWK.X)
+		y, _ := base64.RawURLEncoding.DecodeString(header.JWK.Y)
+		stub.accountKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+		w.Header().Set("Location", url+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "valid"})
+	case "/order":
+		var order struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		json.Unmarshal(payload, &order)
+		stub.domain = order.Identifiers[0].Value
+		stub.writeOrder(w, http.StatusCreated)
+	case "/order/1":
+		stub.writeOrder(w, http.StatusOK)
+	case "/authz/1":
+		status := "pending"
+		if stub.validated {
+			status = "valid"
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": stub.domain},
+			"challenges": []map[string]string{{"type": "http-01", "url": url + "/challenge/1", "token": stub.token, "status": status}},
+		})
+	case "/challenge/1":
+		stub.validated = stub.validateChallenge()
+		status := "invalid"
+		if stub.validated {
+			status = "valid"
+		}
+		json.NewEncoder(w).Encode(map[string]string{"type": "http-01", "url": url + "/challenge/1", "token": stub.token, "status": status})
+	case "/finalize/1":
+		if !stub.validated {
+			http.Error(w, "order is not ready", http.StatusForbidden)
+			return
+		}
+
+		var finalize struct {
+			CSR string `json:"csr"`
+		}
+		json.Unmarshal(payload, &finalize)
+		der, _ := base64.RawURLEncoding.DecodeString(finalize.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: stub.domain},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		stub.cert, _ = x509.CreateCertificate(rand.Reader, template, stub.ca.cert, csr.PublicKey, stub.ca.key)
+		stub.writeOrder(w, http.StatusOK)
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: stub.cert}))
+		w.Write(stub.ca.pem)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (stub *acmeStub) writeOrder(w http.ResponseWriter, code int) {
+	url := stub.server.URL
+	order := map[string]any{
+		"identifiers":    []map[string]string{{"type": "dns", "value": stub.domain}},
+		"authorizations": []string{url + "/authz/1"},
+		"finalize":       url + "/finalize/1",
+		"status":         "pending",
+	}
+	if stub.validated {
+		order["status"] = "ready"
+	}
+	if stub.cert != nil {
+		order["status"] = "valid"
+		order["certificate"] = url + "/cert/1"
+	}
+
+	w.Header().Set("Location", url+"/order/1")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(order)
+}
+
+// validateChallenge fetches the key authorization from the http-01 challenge listener
+func (stub *acmeStub) validateChallenge() bool {
+	thumbprint, err := acme.JWKThumbprint(stub.accountKey)
+	if err != nil {
+		return false
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+stub.challengeAddr+"/.well-known/acme-challenge/"+stub.token, nil)
+	req.Host = stub.domain
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode == http.StatusOK && string(body) == stub.token+"."+thumbprint
+}
+
+func TestRunAutoTLSIssuance(t *testing.T) {
+	if err := newHelloApp("auto tls").RunAutoTLS("127.0.0.1", 8447, goapi.AutoTLSOptions{}); err == nil {
+		t.Errorf("expecting error without domains")
+	}
+
+	ca := newTestCA(t)
+	stub := newACMEStub(t, ca, "127.0.0.1:8099")
+	cache := &memoryCertCache{data: map[string][]byte{}}
+
+	app := newHelloApp("auto tls issuance")
+	go app.RunAutoTLS("127.0.0.1", 8447, goapi.AutoTLSOptions{
+		Domains:      []string{"acme.test"},
+		Email:        "admin@acme.test",
+		Cache:        cache,
+		DirectoryURL: stub.server.URL + "/directory",
+		RedirectAddr: "127.0.0.1:8099",
+	})
+
+	time.Sleep(time.Millisecond * 200)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{ServerName: "acme.test", RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+
+	// The first handshake obtains the certificate from the ACME server
+	resp, err := client.Get("https://127.0.0.1:8447/hello")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "hello HTTP/2.0" {
+		t.Errorf("expecting response over https got %d %s", resp.StatusCode, body)
+	}
+
+	if issuer := resp.TLS.PeerCertificates[0].Issuer.CommonName; issuer != "test ca" {
+		t.Errorf("expecting certificate issued by the acme server got issuer '%s'", issuer)
+	}
+
+	if _, err := cache.Get(context.Background(), "acme.test"); err != nil {
+		t.Errorf("expecting issued certificate in the cache got %s", err)
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue creates certificate signed by the CA and writes it to dir, returns the cert and key paths
+func (ca *testCA) issue(t *testing.T, dir string, commonName string, usage x509.ExtKeyUsage, dnsNames ...string) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, commonName+".crt")
+	keyFile := filepath.Join(dir, commonName+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certFile, keyFile
+}
+
+func TestRunTLSWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, ca.pem, 0644)
+
+	localCert, localKey := ca.issue(t, dir, "localhost", x509.ExtKeyUsageServerAuth, "localhost")
+	otherCert, otherKey := ca.issue(t, dir, "other", x509.ExtKeyUsageServerAuth, "other.test")
+	clientCert, clientKey := ca.issue(t, dir, "service-a", x509.ExtKeyUsageClientAuth)
+
+	app := newHelloApp("tls options")
+	internal := app.Path("/internal")
+	internal.Methods(goapi.GET)
+	internal.Description("internal")
+	internal.Security(goapi.NewMTLSSecurity(func(cert *x509.Certificate) bool {
+		return cert.Subject.CommonName == "service-a"
+	}))
+	internal.Action(func(request *request.Request) responses.Response {
+		username, _ := goapi.GetUsername(request)
+		return responses.NewHTMLResponse(username, 200)
+	})
+
+	go app.RunTLSWithOptions("127.0.0.1", 8444, goapi.TLSOptions{
+		Certificates:   []goapi.CertificateFiles{{CertFile: localCert, KeyFile: localKey}, {CertFile: otherCert, KeyFile: otherKey}},
+		ReloadInterval: 50 * time.Millisecond,
+		ClientCAFile:   caFile,
+		ClientAuth:     tls.VerifyClientCertIfGiven,
+	})
+
+	time.Sleep(time.Millisecond * 200)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientKeyPair, _ := tls.LoadX509KeyPair(clientCert, clientKey)
+
+	get := func(serverName string, path string, withCert bool) (*http.Response, string) {
+		config := &tls.Config{ServerName: serverName, RootCAs: roots}
+		if withCert {
+			config.Certificates = []tls.Certificate{clientKeyPair}
+		}
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get("https://127.0.0.1:8444" + path)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	if resp, _ := get("other.test", "/hello", false); resp.TLS.PeerCertificates[0].Subject.CommonName != "other" {
+		t.Errorf("expecting certificate selected by SNI got %s", resp.TLS.PeerCertificates[0].Subject)
+	}
+
+	if resp, _ := get("localhost", "/internal", false); resp.StatusCode != 401 {
+		t.Errorf("expecting status-code 401 without client certificate got %d", resp.StatusCode)
+	}
+
+	if resp, body := get("localhost", "/internal", true); resp.StatusCode != 200 || body != "service-a" {
+		t.Errorf("expecting client certificate identity got %d %s", resp.StatusCode, body)
+	}
+
+	// Replace the default certificate, new connections get the new one
+	resp, _ := get("localhost", "/hello", false)
+	oldSerial := resp.TLS.PeerCertificates[0].SerialNumber
+
+	newCert, newKey := ca.issue(t, t.TempDir(), "localhost", x509.ExtKeyUsageServerAuth, "localhost")
+	data, _ := os.ReadFile(newCert)
+	os.WriteFile(localCert, data, 0644)
+	data, _ = os.ReadFile(newKey)
+	os.WriteFile(localKey, data, 0600)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(localCert, future, future)
+
+	time.Sleep(time.Millisecond * 200)
+
+	if resp, _ := get("localhost", "/hello", false); resp.TLS.PeerCertificates[0].SerialNumber.Cmp(oldSerial) == 0 {
+		t.Errorf("expecting reloaded certificate")
+	}
+}
+
+// protocolHeaderMiddleware exposes the negotiated protocol in the X-Protocol header
+type protocolHeaderMiddleware struct{}
+
+func (protocolHeaderMiddleware) Apply(next middlewares.AppHandler) middlewares.AppHandler {
+	return func(request *request.Request) responses.Response {
+		response := next(request)
+		response.Headers().Set("X-Protocol", request.Protocol())
+		return response
+	}
+}
+
+func TestRunH2C(t *testing.T) {
+	app := newHelloApp("h2c")
+	app.Middlewares(protocolHeaderMiddleware{})
+	go app.RunH2C("127.0.0.1", 8090)
+
+	time.Sleep(time.Millisecond * 200)
+
+	// HTTP/2 with prior knowledge over plain tcp
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network string, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+
+	resp, err := client.Get("http://127.0.0.1:8090/hello")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello HTTP/2.0" || resp.Header.Get("X-Protocol") != "h2c" {
+		t.Errorf("expecting h2c response got %s '%s'", body, resp.Header.Get("X-Protocol"))
+	}
+
+	resp, err = http.Get("http://127.0.0.1:8090/hello")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	body, _ = io.ReadAll(resp.Body)
+	if string(body) != "hello HTTP/1.1" || resp.Header.Get("X-Protocol") != "http/1.1" {
+		t.Errorf("expecting http/1.1 response got %s '%s'", body, resp.Header.Get("X-Protocol"))
+	}
+}
+
+func TestRunHTTP3(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, dir, "localhost", x509.ExtKeyUsageServerAuth, "localhost")
+
+	app := newHelloApp("http3")
+	app.Middlewares(protocolHeaderMiddleware{})
+	go app.RunHTTP3("127.0.0.1", 8445, goapi.TLSOptions{
+		Certificates: []goapi.CertificateFiles{{CertFile: certFile, KeyFile: keyFile}},
+	})
+
+	time.Sleep(time.Millisecond * 200)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{ServerName: "localhost", RootCAs: roots}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: true}}
+	resp, err := client.Get("https://127.0.0.1:8445/hello")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	if !strings.Contains(resp.Header.Get("Alt-Svc"), `h3=":8445"`) || resp.Header.Get("X-Protocol") != "h2" {
+		t.Errorf("expecting h2 response advertising http3 got '%s' '%s'", resp.Header.Get("Alt-Svc"), resp.Header.Get("X-Protocol"))
+	}
+
+	transport := &http3.Transport{TLSClientConfig: config}
+	defer transport.Close()
+
+	resp, err = (&http.Client{Transport: transport}).Get("https://127.0.0.1:8445/hello")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello HTTP/3.0" || resp.Header.Get("X-Protocol") != "h3" {
+		t.Errorf("expecting http3 response got %s '%s'", body, resp.Header.Get("X-Protocol"))
+	}
+}
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestServeListeners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+
+	unixListener, err := goapi.ListenUnix(path, 0660)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0660 {
+		t.Errorf("expecting socket mode 0660 got %s", info.Mode().Perm())
+	}
+
+	if _, err := goapi.ListenUnix(path, 0660); err == nil {
+		t.Errorf("expecting error for socket in use")
+	}
+
+	// The socket is created in a private directory and moved into place
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 || unixListener.Addr().String() != path {
+		t.Errorf("expecting only the socket at %s got %v %s", path, entries, unixListener.Addr())
+	}
+
+	closedPath := filepath.Join(t.TempDir(), "closed.sock")
+	closed, err := goapi.ListenUnix(closedPath, 0600)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	closed.Close()
+	if _, err := os.Stat(closedPath); !os.IsNotExist(err) {
+		t.Errorf("expecting socket to be removed on close got %v", err)
+	}
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:8091")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	app := newHelloApp("listeners")
+	go app.ServeListeners(unixListener, tcpListener)
+
+	time.Sleep(time.Millisecond * 100)
+
+	for _, c := range []struct {
+		client *http.Client
+		url    string
+	}{
+		{unixClient(path), "http://unix/hello"},
+		{http.DefaultClient, "http://127.0.0.1:8091/hello"},
+	} {
+		resp, err := c.client.Get(c.url)
+		if err != nil {
+			t.Fatalf("not expecting error: %s", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "hello HTTP/1.1" {
+			t.Errorf("expecting response from %s got %s", c.url, body)
+		}
+	}
+}
+
+// TestSystemdHelperProcess is the socket activated process started by TestRunSystemd
+func TestSystemdHelperProcess(t *testing.T) {
+	if os.Getenv("GOAPI_SYSTEMD_HELPER") != "1" {
+		t.Skip("helper process")
+	}
+
+	// systemd sets the pid of the activated process
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	newHelloApp("systemd").RunSystemd()
+}
+
+func TestRunSystemd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "systemd.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	file, _ := listener.(*net.UnixListener).File()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdHelperProcess$")
+	cmd.Env = append(os.Environ(), "GOAPI_SYSTEMD_HELPER=1", "LISTEN_FDS=1", "LISTEN_FDNAMES=api")
+	cmd.ExtraFiles = []*os.File{file} // fd 3 in the child
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+	defer cmd.Process.Kill()
+
+	// The socket accepts connections before the child serves them
+	resp, err := unixClient(path).Get("http://unix/hello")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello HTTP/1.1" {
+		t.Errorf("expecting response from the activated process got %s", body)
+	}
+}
+
+// localTunnel is Tunnel that listens on a local port
+type localTunnel struct {
+	addr string
+	url  string
+}
+
+func (lt *localTunnel) Listen(context.Context) (net.Listener, string, error) {
+	listener, err := net.Listen("tcp", lt.addr)
+	return listener, lt.url, err
+}
+
+func TestRunTunnel(t *testing.T) {
+	app := newHelloApp("tunnel")
+	go app.RunTunnel(&localTunnel{addr: "127.0.0.1:8093", url: "https://goapi.tunnel.test"})
+
+	time.Sleep(time.Millisecond * 100)
+
+	resp, err := http.Get("http://127.0.0.1:8093/openapi.json")
+	if err != nil {
+		t.Fatalf("not expecting error: %s", err)
+	}
+
+	var schema struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	}
+	json.NewDecoder(resp.Body).Decode(&schema)
+
+	if len(schema.Servers) != 1 || schema.Servers[0].URL != "https://goapi.tunnel.test" {
+		t.Errorf("expecting tunnel url in the openapi servers got %v", schema.Servers)
+	}
+}
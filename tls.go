@@ -0,0 +1,233 @@
+package goapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificateFiles is a pair of PEM certificate (with the chain) and key files.
+type CertificateFiles struct {
+	CertFile string
+	KeyFile  string
+}
+
+// TLSOptions configures the TLS of RunTLSWithOptions.
+type TLSOptions struct {
+	// Certificates are selected by the SNI server name, the first certificate is the default.
+	Certificates []CertificateFiles
+
+	// How often the certificate and CA files are checked for changes, default to 10 seconds.
+	// Changed files are reloaded without restarting the server.
+	ReloadInterval time.Duration
+
+	// PEM bundle of the CAs that sign client certificates, enables mutual TLS.
+	ClientCAFile string
+
+	// Client certificate policy, default to tls.RequireAndVerifyClientCert when ClientCAFile is set.
+	// Use tls.VerifyClientCertIfGiven to mix mutual TLS views (MTLSSecurity) with public views.
+	ClientAuth tls.ClientAuthType
+
+	MinVersion uint16 // default to tls.VersionTLS12
+}
+
+// certificateStore keeps the loaded certificates and reloads them when the files change
+type certificateStore struct {
+	options TLSOptions
+
+	lock         sync.RWMutex
+	certificates []*tls.Certificate
+	clientCAs    *x509.CertPool
+	modTimes     map[string]time.Time
+}
+
+// NewTLSConfig creates TLS config from the options, the certificates are reloaded when the files change
+// until stop is called.
+func NewTLSConfig(options TLSOptions) (config *tls.Config, stop func(), err error) {
+	if len(options.Certificates) == 0 {
+		return nil, nil, errors.New("tls requires at least one certificate")
+	}
+
+	if options.ReloadInterval == 0 {
+		options.ReloadInterval = 10 * time.Second
+	}
+	if options.MinVersion == 0 {
+		options.MinVersion = tls.VersionTLS12
+	}
+	if options.ClientCAFile != "" && options.ClientAuth == tls.NoClientCert {
+		options.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	store := &certificateStore{options: options}
+	if err := store.load(); err != nil {
+		return nil, nil, err
+	}
+
+	config = &tls.Config{
+		MinVersion:     options.MinVersion,
+		ClientAuth:     options.ClientAuth,
+		GetCertificate: store.getCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if options.ClientCAFile != "" {
+		// Return config with the current client CAs, they may be reloaded
+		base := config.Clone()
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientConfig := base.Clone()
+			store.lock.RLock()
+			clientConfig.ClientCAs = store.clientCAs
+			store.lock.RUnlock()
+			return clientConfig, nil
+		}
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	go store.watch(done)
+
+	return config, func() { once.Do(func() { close(done) }) }, nil
+}
+
+func (cs *certificateStore) files() []string {
+	files := make([]string, 0, 2*len(cs.options.Certificates)+1)
+	for _, cert := range cs.options.Certificates {
+		files = append(files, cert.CertFile, cert.KeyFile)
+	}
+	if cs.options.ClientCAFile != "" {
+		files = append(files, cs.options.ClientCAFile)
+	}
+	return files
+}
+
+// load reads all the files, the current certificates are kept when any of them is invalid
+func (cs *certificateStore) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range cs.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	certificates := make([]*tls.Certificate, 0, len(cs.options.Certificates))
+	for _, files := range cs.options.Certificates {
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+
+		certificates = append(certificates, &cert)
+	}
+
+	var clientCAs *x509.CertPool
+	if cs.options.ClientCAFile != "" {
+		data, err := os.ReadFile(cs.options.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", cs.options.ClientCAFile)
+		}
+	}
+
+	cs.lock.Lock()
+	cs.certificates = certificates
+	cs.clientCAs = clientCAs
+	cs.modTimes = modTimes
+	cs.lock.Unlock()
+
+	return nil
+}
+
+func (cs *certificateStore) changed() bool {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+
+	for _, file := range cs.files() {
+		info, err := os.Stat(file)
+		if err == nil && !info.ModTime().Equal(cs.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cs *certificateStore) watch(done chan struct{}) {
+	ticker := time.NewTicker(cs.options.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !cs.changed() {
+				continue
+			}
+
+			if err := cs.load(); err != nil {
+				log.Printf("tls: failed to reload certificates, keeping the current ones: %s\n", err)
+				continue
+			}
+			log.Println("tls: certificates reloaded")
+		}
+	}
+}
+
+// getCertificate selects the certificate by the SNI server name
+func (cs *certificateStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+
+	if hello.ServerName != "" {
+		for _, cert := range cs.certificates {
+			if cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return cert, nil
+			}
+		}
+	}
+
+	return cs.certificates[0], nil
+}
+
+// RunTLSWithOptions starts the application over HTTPS with hot reloaded certificates, SNI and mutual TLS.
+func (a *App) RunTLSWithOptions(host string, port int, options TLSOptions) error {
+	handler, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	config, stop, err := NewTLSConfig(options)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: handler, TLSConfig: config}
+	a.startup(addr)
+
+	return server.ServeTLS(listener, "", "")
+}
@@ -0,0 +1,98 @@
+package goapi
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"golang.ngrok.com/ngrok"
+	"golang.ngrok.com/ngrok/config"
+)
+
+// Tunnel exposes the application on a public URL, e.g ngrok or cloudflare tunnels.
+type Tunnel interface {
+	// Listen opens the tunnel, returns listener of the connections to the public URL.
+	Listen(ctx context.Context) (listener net.Listener, publicURL string, err error)
+}
+
+// NgrokOptions configures the ngrok tunnel.
+type NgrokOptions struct {
+	Authtoken string // default to the NGROK_AUTHTOKEN environment variable
+	Domain    string // Reserved or custom domain, default to random ngrok domain
+	Region    string // ngrok region (e.g "eu"), default to the closest region
+
+	// Protect the tunnel with HTTP basic auth, username to password.
+	// ngrok requires passwords of 8 characters at least.
+	BasicAuth map[string]string
+
+	// IP restrictions of the tunnel in CIDR notation (e.g "10.0.0.0/8")
+	AllowCIDRs []string
+	DenyCIDRs  []string
+}
+
+type ngrokTunnel struct {
+	options NgrokOptions
+}
+
+// NewNgrokTunnel creates tunnel for RunTunnel using ngrok.
+func NewNgrokTunnel(options NgrokOptions) Tunnel {
+	return &ngrokTunnel{options: options}
+}
+
+func (nt *ngrokTunnel) Listen(ctx context.Context) (net.Listener, string, error) {
+	endpointOptions := make([]config.HTTPEndpointOption, 0)
+	if nt.options.Domain != "" {
+		endpointOptions = append(endpointOptions, config.WithDomain(nt.options.Domain))
+	}
+	for username, password := range nt.options.BasicAuth {
+		endpointOptions = append(endpointOptions, config.WithBasicAuth(username, password))
+	}
+	if len(nt.options.AllowCIDRs) > 0 {
+		endpointOptions = append(endpointOptions, config.WithAllowCIDRString(nt.options.AllowCIDRs...))
+	}
+	if len(nt.options.DenyCIDRs) > 0 {
+		endpointOptions = append(endpointOptions, config.WithDenyCIDRString(nt.options.DenyCIDRs...))
+	}
+
+	connectOptions := []ngrok.ConnectOption{ngrok.WithRegion(nt.options.Region)}
+	if nt.options.Authtoken != "" {
+		connectOptions = append(connectOptions, ngrok.WithAuthtoken(nt.options.Authtoken))
+	} else {
+		connectOptions = append(connectOptions, ngrok.WithAuthtokenFromEnv())
+	}
+
+	tun, err := ngrok.Listen(ctx, config.HTTPEndpoint(endpointOptions...), connectOptions...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return tun, tun.URL(), nil
+}
+
+// RunTunnel starts the application on the tunnel, the public URL is added to the OpenAPI servers.
+func (a *App) RunTunnel(tunnel Tunnel) error {
+	listener, publicURL, err := tunnel.Listen(context.Background())
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	// The docs are generated with the router, add the server before it is built
+	a.servers = append(a.servers, &openapi3.Server{URL: publicURL, Description: "Tunnel"})
+	mux, err := a.handler()
+	if err != nil {
+		return err
+	}
+
+	log.Println("tunnel created:", publicURL)
+	log.Printf("Visit openapi docs at %s%s\n", publicURL, a.openapiDocsURL)
+
+	return http.Serve(listener, mux)
+}
+
+// Use ngrok tunnel for development, use RunTunnel with NewNgrokTunnel for more options.
+func (a *App) RunNgrok(authtoken string) error {
+	return a.RunTunnel(NewNgrokTunnel(NgrokOptions{Authtoken: authtoken}))
+}
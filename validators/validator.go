@@ -9,3 +9,17 @@ type Validator interface {
 	Validate(r *request.Request, paramName string) error
 	UpdateOpenAPISchema(schema *openapi3.Schema)
 }
+
+// ValidationError is the error of a parameter that failed validation.
+type ValidationError struct {
+	Parameter string
+	Err       error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
@@ -1,9 +1,10 @@
 package goapi
 
 import (
-	"log"
+	"errors"
 	"net/http"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/hvuhsg/goapi/middlewares"
 	"github.com/hvuhsg/goapi/request"
 	"github.com/hvuhsg/goapi/responses"
@@ -23,14 +24,24 @@ const (
 )
 
 type View struct {
-	path        string
-	methods     []string
-	parameters  map[string]Parameter
-	description string
-	tags        []string
-	depreceted  bool
-	middlewares []middlewares.Middleware
-	action      func(request *request.Request) responses.Response
+	path         string
+	methods      []string
+	parameters   map[string]Parameter
+	description  string
+	summary      string
+	operationID  string
+	externalDocs *openapi3.ExternalDocs
+	extensions   map[string]interface{}
+	tags         []string
+	depreceted   bool
+	middlewares  []middlewares.Middleware
+	action       func(request *request.Request) responses.Response
+	errorHandler ErrorHandler
+
+	security            []securityRequirement
+	optionalSecurity    bool
+	appSecurity         []securityRequirement // Used when the view has no security of its own
+	appOptionalSecurity bool
 }
 
 func NewView(path string) *View {
@@ -39,10 +50,12 @@ func NewView(path string) *View {
 	view.methods = make([]string, 0)
 	view.parameters = make(map[string]Parameter)
 	view.description = ""
+	view.extensions = make(map[string]interface{})
 	view.tags = make([]string, 0)
 	view.depreceted = false
 	view.middlewares = make([]middlewares.Middleware, 0)
 	view.action = nil
+	view.errorHandler = DefaultErrorHandler
 	return view
 }
 
@@ -58,12 +71,35 @@ func (v *View) requireDescription() {
 	}
 }
 
+func (v *View) hasMethod(method string) bool {
+	for _, m := range v.methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasSecurity reports whether the view overrides the app security
+func (v *View) hasSecurity() bool {
+	return len(v.security) > 0 || v.optionalSecurity
+}
+
+func (v *View) effectiveSecurity() ([]securityRequirement, bool) {
+	if v.hasSecurity() {
+		return v.security, v.optionalSecurity
+	}
+
+	return v.appSecurity, v.appOptionalSecurity
+}
+
 func (v *View) isValidRequest(r *request.Request) (bool, error) {
 	for paramName, param := range v.parameters {
 		for _, validator := range param.validators {
 			err := validator.Validate(r, paramName)
 			if err != nil {
-				return false, err
+				return false, &validators.ValidationError{Parameter: paramName, Err: err}
 			}
 		}
 	}
@@ -76,6 +112,10 @@ func (v *View) applyMiddlewares(appMiddlewares []middlewares.Middleware) {
 	mm := newMethodsMiddleware(v.methods)
 	v.action = mm.Apply(v.action)
 
+	// Authorize and validate after the app and view middlewares
+	am := newAuthorizationMiddleware(v)
+	v.action = am.Apply(v.action)
+
 	// Apply app middlewares
 	for i := len(appMiddlewares) - 1; i >= 0; i-- {
 		m := appMiddlewares[i]
@@ -90,23 +130,23 @@ func (v *View) applyMiddlewares(appMiddlewares []middlewares.Middleware) {
 }
 
 func (v *View) requestHandler(w http.ResponseWriter, r *http.Request) {
-	defer func() {
-		// If paniced; responde with 500 internal server error
-		if r := recover(); r != nil {
-			log.Printf("ERROR: %v\n", r)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
-	}()
-
+	// Panics are recovered by the app recovery handler
 	req := request.NewRequest(r)
 
-	isValid, err := v.isValidRequest(req)
-	if !isValid {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
-		return
-	}
+	// CSRF is checked by the authorization middleware
+	middlewares.DeferCSRF(req)
 
 	response := v.action(req)
+	if response == nil {
+		response = v.errorHandler(req, errors.New("view returned nil response"))
+	}
+
+	writeResponse(w, response)
+}
+
+func writeResponse(w http.ResponseWriter, response responses.Response) {
+	// render body before writing the headers, rendering may panic
+	body := response.ToBytes()
 
 	// copy response headers to response writer
 	for k, values := range response.Headers() {
@@ -116,7 +156,7 @@ func (v *View) requestHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(response.StatusCode())
-	w.Write(response.ToBytes())
+	w.Write(body)
 }
 
 // Mark view as deprecated
@@ -141,6 +181,47 @@ func (v *View) Description(description string) *View {
 	return v
 }
 
+// Summary sets short summary of the view, shown next to the path in the docs.
+func (v *View) Summary(summary string) *View {
+	v.summary = summary
+	return v
+}
+
+// OperationID sets the operation id used by code generators for the method names,
+// default to the method and the path (e.g "getUsersProfile" for GET /users/profile), numbered when another path has the same default.
+// Views with multiple methods get the method as prefix (e.g "getProfile" and "postProfile" for "profile").
+func (v *View) OperationID(operationID string) *View {
+	v.operationID = operationID
+	return v
+}
+
+// ExternalDocs links to external documentation of the view.
+func (v *View) ExternalDocs(url string, description string) *View {
+	v.externalDocs = &openapi3.ExternalDocs{URL: url, Description: description}
+	return v
+}
+
+// Extension adds vendor extension to the view operations, the name must start with "x-".
+func (v *View) Extension(name string, value interface{}) *View {
+	requireExtensionName(name)
+	v.extensions[name] = value
+	return v
+}
+
+// Security adds security requirement to the view, overrides the app security.
+// The request must be authenticated by one of the view providers and be granted all the scopes of the requirement,
+// scopes defaults to the provider GetScopes.
+func (v *View) Security(provider SecurityProvider, scopes ...string) *View {
+	v.security = append(v.security, newSecurityRequirement(provider, scopes))
+	return v
+}
+
+// OptionalSecurity allows anonymous requests to the view, overrides the app security.
+func (v *View) OptionalSecurity() *View {
+	v.optionalSecurity = true
+	return v
+}
+
 func (v *View) Middlewares(middlewares ...middlewares.Middleware) {
 	v.middlewares = append(v.middlewares, middlewares...)
 }
@@ -154,9 +235,34 @@ func (v *View) Parameter(paramName string, in string, validators ...validators.V
 
 type AppHandler func(request *request.Request) responses.Response
 
+// AppHandlerE is a view handler that can fail, errors are mapped to responses by the app error handler.
+type AppHandlerE func(request *request.Request) (responses.Response, error)
+
 func (v *View) Action(r AppHandler) {
 	v.requireMethods()
 	v.requireDescription()
 
 	v.action = r
 }
+
+// ActionE sets handler that returns error, the error is converted to response by the app ErrorHandler.
+//
+//	view.ActionE(func(request *request.Request) (responses.Response, error) {
+//		user, ok := users[request.GetString("id")]
+//		if !ok {
+//			return nil, responses.NotFound("user not found")
+//		}
+//		return responses.NewJSONResponse(responses.Json{"name": user.Name}, 200), nil
+//	})
+func (v *View) ActionE(r AppHandlerE) {
+	v.requireMethods()
+	v.requireDescription()
+
+	v.action = func(request *request.Request) responses.Response {
+		response, err := r(request)
+		if err != nil {
+			return v.errorHandler(request, err)
+		}
+		return response
+	}
+}